@@ -0,0 +1,42 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	batchv1 "k8s.io/api/batch/v1"
+)
+
+// JobSpec returns the job the exporter runs, unless a built-in exporter type
+// generates it.
+func (e *Exporter) JobSpec() batchv1.JobSpec {
+	spec := batchv1.JobSpec{
+		Parallelism:             e.Parallelism,
+		Completions:             e.Completions,
+		ActiveDeadlineSeconds:   e.ActiveDeadlineSeconds,
+		BackoffLimit:            e.BackoffLimit,
+		Selector:                e.Selector,
+		ManualSelector:          e.ManualSelector,
+		TTLSecondsAfterFinished: e.TTLSecondsAfterFinished,
+		CompletionMode:          e.CompletionMode,
+		Suspend:                 e.Suspend,
+	}
+	if e.Template != nil {
+		spec.Template = *e.Template
+	}
+
+	return *spec.DeepCopy()
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// BuildInputs returns a copy of the spec without the fields that control how
+// and when the artifact is built or exported rather than what is built.
+// Changing those fields never requires a rebuild.
+func (s *OSArtifactSpec) BuildInputs() *OSArtifactSpec {
+	inputs := s.DeepCopy()
+	inputs.RebuildPolicy = ""
+	inputs.RetryPolicy = nil
+	inputs.BuildTimeout = nil
+	inputs.ExportTimeout = nil
+	inputs.Builder = nil
+	inputs.Resources = nil
+	inputs.Priority = 0
+	inputs.Suspend = false
+	inputs.TTLSecondsAfterFinished = nil
+	inputs.CleanupPolicy = ""
+	inputs.VolumeReclaimPolicy = ""
+	inputs.MaxParallelExporters = nil
+	inputs.Exporters = nil
+	inputs.Serve = false
+
+	return inputs
+}
+
+// ExportInputs returns the fields of the spec that decide what the export
+// stage does with the built files.
+func (s *OSArtifactSpec) ExportInputs() *OSArtifactSpec {
+	return &OSArtifactSpec{
+		Exporters: s.DeepCopy().Exporters,
+		Serve:     s.Serve,
+	}
+}
+
+// BuildHash identifies the build inputs of the spec.
+func (s *OSArtifactSpec) BuildHash() string {
+	return hashSpec(s.BuildInputs())
+}
+
+// ExportHash identifies the export inputs of the spec.
+func (s *OSArtifactSpec) ExportHash() string {
+	return hashSpec(s.ExportInputs())
+}
+
+func hashSpec(spec *OSArtifactSpec) string {
+	// Marshalling a spec cannot fail, it only holds plain values.
+	data, _ := json.Marshal(spec)
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])[:16]
+}
@@ -0,0 +1,50 @@
+package v1alpha2_test
+
+import (
+	"time"
+
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("BuildHash", func() {
+	var spec *osbuilder.OSArtifactSpec
+
+	BeforeEach(func() {
+		spec = &osbuilder.OSArtifactSpec{
+			ImageName: "quay.io/kairos/core-opensuse:latest",
+			ISO:       true,
+		}
+	})
+
+	It("ignores fields that do not change the build", func() {
+		hash := spec.BuildHash()
+
+		spec.Suspend = true
+		spec.Priority = 10
+		spec.BuildTimeout = &metav1.Duration{Duration: time.Hour}
+		Expect(spec.BuildHash()).To(Equal(hash))
+	})
+
+	It("ignores the exporters", func() {
+		hash := spec.BuildHash()
+		exportHash := spec.ExportHash()
+
+		spec.Serve = true
+		spec.Exporters = []osbuilder.Exporter{{Name: "upload"}}
+		Expect(spec.BuildHash()).To(Equal(hash))
+		Expect(spec.ExportHash()).ToNot(Equal(exportHash))
+	})
+
+	It("changes with the build inputs", func() {
+		hash := spec.BuildHash()
+
+		exportHash := spec.ExportHash()
+
+		spec.CloudImage = true
+		Expect(spec.BuildHash()).ToNot(Equal(hash))
+		Expect(spec.ExportHash()).To(Equal(exportHash))
+	})
+})
@@ -0,0 +1,109 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"text/template"
+)
+
+const (
+	// DefaultS3Path is the object key template used when
+	// spec.exporters[].s3.path is not set.
+	DefaultS3Path = "{{ .Namespace }}/{{ .Name }}/{{ .File }}"
+	// DefaultS3Region is the region used when spec.exporters[].s3.region is
+	// not set.
+	DefaultS3Region = "us-east-1"
+)
+
+// Default sets the unset fields of the S3 exporter.
+func (e *S3Exporter) Default() {
+	if e.Path == "" {
+		e.Path = DefaultS3Path
+	}
+	if e.Region == "" {
+		e.Region = DefaultS3Region
+	}
+}
+
+// Uploads reports whether files of the given type are uploaded.
+func (e *S3Exporter) Uploads(fileType ArtifactType) bool {
+	if len(e.Types) == 0 {
+		return true
+	}
+	for _, t := range e.Types {
+		if t == fileType {
+			return true
+		}
+	}
+	return false
+}
+
+// ObjectKey renders the key a file is uploaded to.
+func (e *S3Exporter) ObjectKey(data S3PathData) (string, error) {
+	pathTemplate := e.Path
+	if pathTemplate == "" {
+		pathTemplate = DefaultS3Path
+	}
+
+	tmpl, err := template.New("path").Option("missingkey=error").Parse(pathTemplate)
+	if err != nil {
+		return "", err
+	}
+	var key strings.Builder
+	if err := tmpl.Execute(&key, data); err != nil {
+		return "", err
+	}
+
+	joined := path.Join(e.Prefix, key.String())
+	if joined == "." || strings.HasSuffix(key.String(), "/") {
+		return "", fmt.Errorf("path %q renders the key %q, which does not name an object", pathTemplate, joined)
+	}
+
+	return strings.TrimPrefix(joined, "/"), nil
+}
+
+// ObjectURL returns the URL of the object stored under key.
+func (e *S3Exporter) ObjectURL(key string) string {
+	escaped := make([]string, 0, strings.Count(key, "/")+1)
+	for _, segment := range strings.Split(key, "/") {
+		escaped = append(escaped, url.PathEscape(segment))
+	}
+	objectPath := strings.Join(escaped, "/")
+
+	if e.Endpoint == "" {
+		region := e.Region
+		if region == "" {
+			region = DefaultS3Region
+		}
+		if e.ForcePathStyle {
+			return fmt.Sprintf("https://s3.%s.amazonaws.com/%s/%s", region, e.Bucket, objectPath)
+		}
+		return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", e.Bucket, region, objectPath)
+	}
+
+	endpoint, err := url.Parse(e.Endpoint)
+	if err != nil || e.ForcePathStyle {
+		return fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(e.Endpoint, "/"), e.Bucket, objectPath)
+	}
+	endpoint.Host = e.Bucket + "." + endpoint.Host
+	endpoint.Path = strings.TrimSuffix(endpoint.Path, "/")
+	return fmt.Sprintf("%s/%s", endpoint.String(), objectPath)
+}
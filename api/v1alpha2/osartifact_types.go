@@ -19,10 +19,16 @@ package v1alpha2
 import (
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // OSArtifactSpec defines the desired state of OSArtifact
+// +kubebuilder:validation:XValidation:rule="has(self.imageName) || has(self.baseImageName) || has(self.baseImageDockerfile)",message="one of imageName, baseImageName or baseImageDockerfile must be set"
+// +kubebuilder:validation:XValidation:rule="!has(self.baseImageName) || !has(self.baseImageDockerfile)",message="baseImageName and baseImageDockerfile are mutually exclusive"
+// +kubebuilder:validation:XValidation:rule="!has(self.azureImage) || !self.azureImage || (has(self.cloudImage) && self.cloudImage)",message="azureImage requires cloudImage"
+// +kubebuilder:validation:XValidation:rule="!has(self.gceImage) || !self.gceImage || (has(self.cloudImage) && self.cloudImage)",message="gceImage requires cloudImage"
+// +kubebuilder:validation:XValidation:rule="!has(self.netboot) || !self.netboot || has(self.netbootURL)",message="netboot requires netbootURL"
 type OSArtifactSpec struct {
 	// There are 3 ways to specify a Kairos image:
 
@@ -38,6 +44,8 @@ type OSArtifactSpec struct {
 	ISO bool `json:"iso,omitempty"`
 
 	//Disk-only stuff
+	// DiskSize is the size, in megabytes, the raw disk image is extended to.
+	// +kubebuilder:validation:Pattern=`^[0-9]+$`
 	DiskSize   string `json:"diskSize,omitempty"`
 	CloudImage bool   `json:"cloudImage,omitempty"`
 	AzureImage bool   `json:"azureImage,omitempty"`
@@ -54,10 +62,430 @@ type OSArtifactSpec struct {
 	KairosRelease string   `json:"kairosRelease,omitempty"`
 
 	ImagePullSecrets []corev1.LocalObjectReference     `json:"imagePullSecrets,omitempty"`
-	Exporters        []batchv1.JobSpec                 `json:"exporters,omitempty"`
+	Exporters        []Exporter                        `json:"exporters,omitempty"`
 	Volume           *corev1.PersistentVolumeClaimSpec `json:"volume,omitempty"`
+
+	// MaxParallelExporters limits how many exporter jobs run at once. All
+	// the exporters whose dependencies succeeded run at once when unset.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxParallelExporters *int32 `json:"maxParallelExporters,omitempty"`
+
+	// Serve copies the artifacts to the HTTP server of the operator once
+	// they are built, under /<namespace>/<name>/, and lists their download
+	// URLs in status.artifacts. The operator must have serving enabled.
+	// +optional
+	Serve bool `json:"serve,omitempty"`
+
+	// ToolImage runs auroraboot and luet in the builder pod. Defaults to the
+	// tool image the operator was started with.
+	// +optional
+	ToolImage string `json:"toolImage,omitempty"`
+
+	// RebuildPolicy controls whether changing the spec of an artifact that
+	// is building or already built starts a new build.
+	// +kubebuilder:default=OnSpecChange
+	// +optional
+	RebuildPolicy RebuildPolicy `json:"rebuildPolicy,omitempty"`
+
+	// RetryPolicy controls whether a failed builder pod is replaced by a
+	// new one. Builds are not retried when unset.
+	// +optional
+	RetryPolicy *RetryPolicy `json:"retryPolicy,omitempty"`
+
+	// BuildTimeout bounds how long a builder pod may run before the build
+	// fails with reason TimedOut. Each retry gets the full timeout.
+	// +optional
+	BuildTimeout *metav1.Duration `json:"buildTimeout,omitempty"`
+
+	// ExportTimeout bounds how long the exporters may run, all together,
+	// before the export fails with reason TimedOut.
+	// +optional
+	ExportTimeout *metav1.Duration `json:"exportTimeout,omitempty"`
+
+	// Builder controls where the builder pod is scheduled.
+	// +optional
+	Builder *BuilderSpec `json:"builder,omitempty"`
+
+	// Resources sets the compute resources of the builder pod containers.
+	// Unset steps fall back to the defaults of the operator.
+	// +optional
+	Resources *BuildResources `json:"resources,omitempty"`
+
+	// Priority orders the artifacts waiting for a build slot when the
+	// operator limits concurrent builds. Higher values are built first,
+	// artifacts of the same priority in creation order.
+	// +optional
+	Priority int32 `json:"priority,omitempty"`
+
+	// Suspend stops the build or the exporters of the artifact. When it is
+	// unset again, the interrupted stage starts over. Suspending an artifact
+	// that is Ready or Error has no effect.
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+
+	// TTLSecondsAfterFinished deletes the artifact, along with its volume
+	// and everything else the operator created for it, this many seconds
+	// after it became Ready or failed. Artifacts are kept when unset.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+
+	// CleanupPolicy controls whether the builder pod and artifacts volume
+	// are deleted once every exporter succeeded. The OSArtifact is kept
+	// either way, its status recording what was built. DeleteVolume may not
+	// be combined with a volumeReclaimPolicy that keeps the volume.
+	// +kubebuilder:default=Keep
+	// +optional
+	CleanupPolicy CleanupPolicy `json:"cleanupPolicy,omitempty"`
+
+	// VolumeReclaimPolicy controls whether the artifacts volume is deleted
+	// along with the OSArtifact.
+	// +kubebuilder:default=Delete
+	// +optional
+	VolumeReclaimPolicy VolumeReclaimPolicy `json:"volumeReclaimPolicy,omitempty"`
+
+	// Push pushes the Kairos image packed by the build to a registry.
+	// +optional
+	Push *PushSpec `json:"push,omitempty"`
+
+	// OCIArtifact publishes the built files as an OCI artifact. Combined
+	// with cleanupPolicy DeleteVolume, the registry replaces the volume.
+	// +optional
+	OCIArtifact *OCIArtifactSpec `json:"ociArtifact,omitempty"`
+
+	// Signing writes a detached signature next to every built file. With
+	// cosign, the pushed image and OCI artifact are signed as well.
+	// +optional
+	Signing *SigningSpec `json:"signing,omitempty"`
+}
+
+// PushSpec describes where the packed Kairos image is pushed.
+type PushSpec struct {
+	// Destination is the image reference pushed to, e.g.
+	// registry.example.com/kairos/custom:v1.0.0.
+	Destination string `json:"destination"`
+
+	// Tags are further tags of the destination repository pointing at the
+	// pushed image.
+	// +optional
+	Tags []string `json:"tags,omitempty"`
+
+	// CredentialsSecretRef names a kubernetes.io/dockerconfigjson Secret
+	// holding the registry credentials.
+	// +optional
+	CredentialsSecretRef *corev1.LocalObjectReference `json:"credentialsSecretRef,omitempty"`
+
+	// Insecure allows pushing over plain HTTP and to registries whose
+	// certificate cannot be verified.
+	// +optional
+	Insecure bool `json:"insecure,omitempty"`
+
+	// CARef points to a Secret key holding the PEM encoded CA certificate
+	// the registry certificate is verified with, in addition to the system
+	// roots. The key defaults to ca.crt.
+	// +optional
+	CARef *SecretKeySelector `json:"caRef,omitempty"`
+}
+
+// SigningMethod picks the tool signing the artifacts.
+// +kubebuilder:validation:Enum=Cosign;GPG
+type SigningMethod string
+
+const (
+	// SigningCosign writes a <file>.sig checked with cosign verify-blob and
+	// signs the pushed images. Nothing is uploaded to a transparency log.
+	SigningCosign SigningMethod = "Cosign"
+	// SigningGPG writes an armored <file>.asc. Pushed images are not signed.
+	SigningGPG SigningMethod = "GPG"
+)
+
+// SigningSpec selects the key the artifacts are signed with.
+type SigningSpec struct {
+	Method SigningMethod `json:"method"`
+
+	// KeyRef points to a Secret key holding the private key, as written by
+	// cosign generate-key-pair or gpg --armor --export-secret-keys. The key
+	// defaults to cosign.key or gpg.key.
+	KeyRef SecretKeySelector `json:"keyRef"`
+
+	// PasswordKey is the key of the same Secret holding the password of
+	// the private key, if it has one.
+	// +optional
+	PasswordKey string `json:"passwordKey,omitempty"`
+}
+
+// OCIArtifactSpec publishes the built files as an OCI artifact, with one
+// layer per file. Insecure pushes over plain HTTP, as local registries
+// expect.
+type OCIArtifactSpec struct {
+	PushSpec `json:",inline"`
+
+	// Types restricts the artifact to the files of these types. Defaults
+	// to the ISO, the disk images and the netboot files.
+	// +optional
+	Types []ArtifactType `json:"types,omitempty"`
+
+	// Annotations are added to the manifest, along with the Kairos version
+	// and flavor of the built image.
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// VolumeReclaimPolicy controls what happens to the artifacts volume when its
+// OSArtifact is deleted.
+// +kubebuilder:validation:Enum=Delete;Retain;Orphan
+type VolumeReclaimPolicy string
+
+const (
+	// VolumeReclaimDelete deletes the volume along with the artifact.
+	VolumeReclaimDelete VolumeReclaimPolicy = "Delete"
+	// VolumeReclaimRetain keeps the volume, labelled with the name of the
+	// artifact. A new OSArtifact of the same name adopts it.
+	VolumeReclaimRetain VolumeReclaimPolicy = "Retain"
+	// VolumeReclaimOrphan keeps the volume and removes every reference to
+	// the artifact from it.
+	VolumeReclaimOrphan VolumeReclaimPolicy = "Orphan"
+)
+
+// CleanupPolicy controls what happens to the build resources of an artifact
+// once it is Ready.
+// +kubebuilder:validation:Enum=Keep;DeleteVolume
+type CleanupPolicy string
+
+const (
+	// CleanupKeep keeps the builder pod and the artifacts volume.
+	CleanupKeep CleanupPolicy = "Keep"
+	// CleanupDeleteVolume deletes the builder pod and the artifacts volume
+	// after a successful export.
+	CleanupDeleteVolume CleanupPolicy = "DeleteVolume"
+)
+
+// BuildResources sets the compute resources of the builder pod containers,
+// per build step.
+type BuildResources struct {
+	// Default applies to every container without a step specific setting.
+	// +optional
+	Default *corev1.ResourceRequirements `json:"default,omitempty"`
+	// Unpack applies to the containers unpacking images into the rootfs.
+	// +optional
+	Unpack *corev1.ResourceRequirements `json:"unpack,omitempty"`
+	// Kaniko applies to the kaniko-build container.
+	// +optional
+	Kaniko *corev1.ResourceRequirements `json:"kaniko,omitempty"`
+	// ISO applies to the build-iso and build-netboot containers.
+	// +optional
+	ISO *corev1.ResourceRequirements `json:"iso,omitempty"`
+	// CloudImage applies to the containers building the raw, Azure and GCE
+	// images.
+	// +optional
+	CloudImage *corev1.ResourceRequirements `json:"cloudImage,omitempty"`
+}
+
+// BuilderSpec holds the scheduling settings of the builder pod. They follow
+// the fields of the same name in corev1.PodSpec.
+type BuilderSpec struct {
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+	// +optional
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+	// +optional
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+	// +optional
+	RuntimeClassName *string `json:"runtimeClassName,omitempty"`
+	// +optional
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+
+	// ApplyToExporters also applies these settings to the exporter jobs,
+	// for every field their pod template leaves unset.
+	// +optional
+	ApplyToExporters bool `json:"applyToExporters,omitempty"`
+}
+
+// Exporter is a job run with the artifacts volume mounted at /artifacts once
+// the build succeeded. Built-in exporter types generate the job, in which
+// case the job fields are left unset. The job fields are those of
+// batchv1.JobSpec, with an optional template.
+// +kubebuilder:validation:XValidation:rule="has(self.template) != has(self.s3)",message="exactly one of template or s3 must be set"
+type Exporter struct {
+	// Template is the pod template of the exporter job.
+	// +optional
+	Template *corev1.PodTemplateSpec `json:"template,omitempty"`
+	// +optional
+	Parallelism *int32 `json:"parallelism,omitempty"`
+	// +optional
+	Completions *int32 `json:"completions,omitempty"`
+	// +optional
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+	// +optional
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+	// +optional
+	ManualSelector *bool `json:"manualSelector,omitempty"`
+	// +optional
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+	// +optional
+	CompletionMode *batchv1.CompletionMode `json:"completionMode,omitempty"`
+	// +optional
+	Suspend *bool `json:"suspend,omitempty"`
+
+	// Name identifies the exporter in dependsOn. It must be a DNS label.
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// DependsOn names the exporters that must succeed before this one
+	// starts. The exporters without dependencies start right away.
+	// +optional
+	DependsOn []string `json:"dependsOn,omitempty"`
+
+	// AllowFailure lets the artifact become Ready when this exporter fails.
+	// The exporters depending on it are skipped.
+	// +optional
+	AllowFailure bool `json:"allowFailure,omitempty"`
+
+	// S3 uploads the artifacts to an S3 compatible object storage.
+	// +optional
+	S3 *S3Exporter `json:"s3,omitempty"`
+
+	// Cleanup runs when the OSArtifact is deleted, to undo what the exporter
+	// did, e.g. delete the uploaded ISO. It only runs if status.exports
+	// records a job for the exporter, and the OSArtifact is kept until it
+	// succeeded.
+	// +optional
+	Cleanup *ExporterCleanup `json:"cleanup,omitempty"`
+}
+
+// ExporterCleanup is the container of the job undoing an exporter. It runs
+// with the scheduling of the exporters, and the artifacts volume mounted at
+// /artifacts if it still exists.
+type ExporterCleanup struct {
+	// Image of the container.
+	// +kubebuilder:validation:MinLength=1
+	Image string `json:"image"`
+
+	// Command overrides the entrypoint of the image.
+	// +optional
+	Command []string `json:"command,omitempty"`
+
+	// Args are passed to the command.
+	// +optional
+	Args []string `json:"args,omitempty"`
+
+	// Env sets environment variables in the container.
+	// +optional
+	Env []corev1.EnvVar `json:"env,omitempty"`
+
+	// EnvFrom sets environment variables from ConfigMaps and Secrets, such
+	// as the credentials the exporter used.
+	// +optional
+	EnvFrom []corev1.EnvFromSource `json:"envFrom,omitempty"`
+}
+
+// S3Exporter uploads the artifacts to a bucket with the AWS CLI. Large files
+// are uploaded in parts.
+type S3Exporter struct {
+	// Bucket is the name of the bucket the artifacts are uploaded to.
+	// +kubebuilder:validation:MinLength=1
+	Bucket string `json:"bucket"`
+
+	// Prefix is prepended to the key of every object.
+	// +optional
+	Prefix string `json:"prefix,omitempty"`
+
+	// Path is a Go template rendering the key of each object below Prefix.
+	// It can use .Namespace, .Name and .Generation of the artifact, and
+	// .File and .Type of the uploaded file.
+	// +kubebuilder:default="{{ .Namespace }}/{{ .Name }}/{{ .File }}"
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// Endpoint is the URL of an S3 compatible service, such as MinIO.
+	// AWS is used when unset.
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// Region of the bucket.
+	// +kubebuilder:default=us-east-1
+	// +optional
+	Region string `json:"region,omitempty"`
+
+	// ForcePathStyle addresses the bucket in the URL path rather than in
+	// the host name, as most S3 compatible services expect.
+	// +optional
+	ForcePathStyle bool `json:"forcePathStyle,omitempty"`
+
+	// CredentialsSecretRef names a Secret whose keys are exposed to the AWS
+	// CLI as environment variables, typically AWS_ACCESS_KEY_ID and
+	// AWS_SECRET_ACCESS_KEY.
+	// +optional
+	CredentialsSecretRef *corev1.LocalObjectReference `json:"credentialsSecretRef,omitempty"`
+
+	// Types restricts the upload to the files of these types. Every file
+	// is uploaded when unset.
+	// +optional
+	Types []ArtifactType `json:"types,omitempty"`
+
+	// MultipartThreshold is the size from which files are uploaded in
+	// parts.
+	// +optional
+	MultipartThreshold *resource.Quantity `json:"multipartThreshold,omitempty"`
+
+	// MultipartChunkSize is the size of each part of a multipart upload.
+	// +optional
+	MultipartChunkSize *resource.Quantity `json:"multipartChunkSize,omitempty"`
+}
+
+// S3PathData is the data S3Exporter.Path is rendered with.
+// +kubebuilder:object:generate=false
+type S3PathData struct {
+	Namespace  string
+	Name       string
+	Generation int64
+	File       string
+	Type       ArtifactType
+}
+
+// RetryPolicy controls how failed builds are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the number of builder pods created for a generation,
+	// including the first one, before the artifact is marked as failed.
+	// +kubebuilder:default=1
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=10
+	// +optional
+	MaxAttempts int32 `json:"maxAttempts,omitempty"`
+
+	// Backoff is how long to wait before the second attempt. It doubles
+	// after every further failure, up to 10 minutes.
+	// +kubebuilder:default="30s"
+	// +optional
+	Backoff *metav1.Duration `json:"backoff,omitempty"`
+
+	// RetryOn lists the failure reasons that are retried. Defaults to
+	// Evicted and ResolutionFailed, which cover transient registry errors.
+	// +optional
+	RetryOn []RetryableFailure `json:"retryOn,omitempty"`
 }
 
+// RetryableFailure is a failure reason a build can be retried on.
+// +kubebuilder:validation:Enum=Evicted;ResolutionFailed;BuildFailed;PushFailed;TimedOut
+type RetryableFailure string
+
+// RebuildPolicy controls what happens when the spec of an artifact changes.
+// +kubebuilder:validation:Enum=OnSpecChange;Never
+type RebuildPolicy string
+
+const (
+	// RebuildOnSpecChange tears down the previous build and starts a new
+	// one whenever metadata.generation changes.
+	RebuildOnSpecChange RebuildPolicy = "OnSpecChange"
+	// RebuildNever makes the spec immutable once the artifact is created.
+	RebuildNever RebuildPolicy = "Never"
+)
+
 type SecretKeySelector struct {
 	Name string `json:"name"`
 	// +optional
@@ -68,21 +496,289 @@ type ArtifactPhase string
 
 const (
 	Pending   = "Pending"
+	Queued    = "Queued"
 	Building  = "Building"
 	Exporting = "Exporting"
+	Suspended = "Suspended"
+	Deleting  = "Deleting"
 	Ready     = "Ready"
 	Error     = "Error"
 )
 
+// Condition types set on OSArtifactStatus.Conditions.
+const (
+	// ConditionSourceResolved is True once the base image, bundles and
+	// release files have been unpacked into the builder's rootfs.
+	ConditionSourceResolved = "SourceResolved"
+	// ConditionBuilt is True once the builder pod produced all artifacts.
+	ConditionBuilt = "Built"
+	// ConditionExported is True once every exporter job succeeded.
+	ConditionExported = "Exported"
+	// ConditionReady is True once the artifact is built and exported.
+	ConditionReady = "Ready"
+)
+
+// Reasons used in conditions and in OSArtifactStatus.Reason.
+const (
+	ReasonQueued            = "Queued"
+	ReasonResolving         = "Resolving"
+	ReasonResolved          = "Resolved"
+	ReasonResolutionFailed  = "ResolutionFailed"
+	ReasonBuilding          = "Building"
+	ReasonBuildSucceeded    = "BuildSucceeded"
+	ReasonBuildFailed       = "BuildFailed"
+	ReasonVolumeConflict    = "VolumeConflict"
+	ReasonPushFailed        = "PushFailed"
+	ReasonEvicted           = "Evicted"
+	ReasonTimedOut          = "TimedOut"
+	ReasonExporting         = "Exporting"
+	ReasonExportSucceeded   = "ExportSucceeded"
+	ReasonExportFailed      = "ExportFailed"
+	ReasonArtifactAvailable = "ArtifactAvailable"
+	ReasonSpecChanged       = "SpecChanged"
+	ReasonRetrying          = "Retrying"
+	ReasonSuspended         = "Suspended"
+	ReasonResumed           = "Resumed"
+	ReasonCleaningUp        = "CleaningUp"
+	ReasonCleanupFailed     = "CleanupFailed"
+)
+
 // OSArtifactStatus defines the observed state of OSArtifact
 type OSArtifactStatus struct {
 	// +kubebuilder:default=Pending
 	Phase ArtifactPhase `json:"phase,omitempty"`
+
+	// QueuePosition is the position of the artifact in the build queue,
+	// starting at 1, while it is Queued.
+	// +optional
+	QueuePosition int32 `json:"queuePosition,omitempty"`
+
+	// ObservedGeneration is the metadata.generation of the spec the current
+	// build was started from.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// BuildHash identifies the build inputs of the spec the current build
+	// was started from, see OSArtifactSpec.BuildHash. Only a change of the
+	// build inputs causes a rebuild.
+	// +optional
+	BuildHash string `json:"buildHash,omitempty"`
+
+	// ExportHash identifies the export inputs of the spec the exporters last
+	// ran for, see OSArtifactSpec.ExportHash. A change of the export inputs
+	// alone runs the exporters again on the files already built.
+	// +optional
+	ExportHash string `json:"exportHash,omitempty"`
+
+	// StartTime is when the current build was started.
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// ExportStartTime is when the exporters were last started, spec.exportTimeout
+	// is measured from it.
+	// +optional
+	ExportStartTime *metav1.Time `json:"exportStartTime,omitempty"`
+
+	// CompletionTime is when the artifact reached Ready or Error.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Reason is a CamelCase summary of why the artifact is in its phase.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Message is a human-readable explanation of the current phase,
+	// typically describing what failed.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Attempts records the builder pods created for the current generation,
+	// the last entry being the current attempt.
+	// +optional
+	Attempts []BuildAttempt `json:"attempts,omitempty"`
+
+	// Exports records the progress of each exporter, in the order of
+	// spec.exporters.
+	// +optional
+	Exports []ExportStatus `json:"exports,omitempty"`
+
+	// Source describes the image the artifacts were built from.
+	// +optional
+	Source *SourceStatus `json:"source,omitempty"`
+
+	// Push records the image pushed to the registry, see spec.push.
+	// +optional
+	Push *PushStatus `json:"push,omitempty"`
+
+	// OCIArtifact records the OCI artifact pushed to the registry, see
+	// spec.ociArtifact.
+	// +optional
+	OCIArtifact *PushStatus `json:"ociArtifact,omitempty"`
+
+	// Artifacts lists the files the build produced on the artifacts volume.
+	// +optional
+	Artifacts []ArtifactFile `json:"artifacts,omitempty"`
+
+	// Conditions describe the progress of the build, see the Condition*
+	// constants for the types the controller sets.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	// +patchStrategy=merge
+	// +patchMergeKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// AttemptOutcome is the result of a build attempt.
+type AttemptOutcome string
+
+const (
+	AttemptRunning   AttemptOutcome = "Running"
+	AttemptSucceeded AttemptOutcome = "Succeeded"
+	AttemptFailed    AttemptOutcome = "Failed"
+)
+
+// BuildAttempt records the outcome of one builder pod.
+type BuildAttempt struct {
+	// Attempt numbers the builder pods of a generation, starting at 1.
+	Attempt int32 `json:"attempt"`
+	// Pod is the name of the builder pod.
+	Pod string `json:"pod"`
+	// Node is the node the builder pod ran on. Exporters run there when
+	// the artifacts volume can only be attached to one node.
+	// +optional
+	Node string `json:"node,omitempty"`
+	// Outcome tells whether the attempt is still running or how it ended.
+	Outcome AttemptOutcome `json:"outcome"`
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Reason is why the attempt failed.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+	// Message explains why the attempt failed.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// ExportPhase tells where an exporter is at.
+type ExportPhase string
+
+const (
+	// ExportPending exporters wait for their dependencies or a free slot.
+	ExportPending ExportPhase = "Pending"
+	ExportRunning ExportPhase = "Running"
+	// ExportSucceeded exporters have a Complete job.
+	ExportSucceeded ExportPhase = "Succeeded"
+	// ExportFailed exporters have a Failed job.
+	ExportFailed ExportPhase = "Failed"
+	// ExportSkipped exporters never run, as one of their dependencies
+	// failed.
+	ExportSkipped ExportPhase = "Skipped"
+)
+
+// ExportStatus records the progress of an exporter.
+type ExportStatus struct {
+	// Name of the exporter, or its index if it has none.
+	Name string `json:"name"`
+	// Job is the name of the exporter job, once created.
+	// +optional
+	Job string `json:"job,omitempty"`
+	// Phase is the progress of the exporter job.
+	Phase ExportPhase `json:"phase"`
+	// Attempts counts the pods the job created.
+	// +optional
+	Attempts int32 `json:"attempts,omitempty"`
+	// Message explains why the exporter failed or was skipped.
+	// +optional
+	Message string `json:"message,omitempty"`
+	// Outputs are the key=value lines the containers of the succeeded
+	// exporter pod wrote to their termination message, whose path is in
+	// $OSBUILDER_OUTPUTS. Later containers override earlier ones.
+	// +optional
+	Outputs map[string]string `json:"outputs,omitempty"`
+}
+
+// SourceStatus describes the image an artifact was built from. Fields that
+// could not be determined are left empty.
+type SourceStatus struct {
+	// Image is the reference of the source image, unless it was built from
+	// a Dockerfile.
+	// +optional
+	Image string `json:"image,omitempty"`
+	// Digest is the digest the image reference resolved to.
+	// +optional
+	Digest string `json:"digest,omitempty"`
+	// KairosVersion is the KAIROS_VERSION of the built rootfs.
+	// +optional
+	KairosVersion string `json:"kairosVersion,omitempty"`
+	// KairosFlavor is the KAIROS_FLAVOR of the built rootfs.
+	// +optional
+	KairosFlavor string `json:"kairosFlavor,omitempty"`
+}
+
+// PushStatus records an image or OCI artifact pushed to a registry.
+type PushStatus struct {
+	// Image is the repository the image was pushed to.
+	Image string `json:"image"`
+	// Digest is the digest of the pushed manifest.
+	Digest string `json:"digest"`
+	// Tags are the further tags pointing at the pushed image.
+	// +optional
+	Tags []string `json:"tags,omitempty"`
+	// Signature is the cosign signature image of the pushed manifest, the
+	// sha256-<digest>.sig tag of cosign v2.
+	// +optional
+	Signature string `json:"signature,omitempty"`
+}
+
+// ArtifactType classifies the files produced by a build.
+type ArtifactType string
+
+const (
+	ArtifactISO            ArtifactType = "ISO"
+	ArtifactRawImage       ArtifactType = "RawImage"
+	ArtifactAzureImage     ArtifactType = "AzureImage"
+	ArtifactGCEImage       ArtifactType = "GCEImage"
+	ArtifactNetbootKernel  ArtifactType = "NetbootKernel"
+	ArtifactNetbootInitrd  ArtifactType = "NetbootInitrd"
+	ArtifactNetbootRootfs  ArtifactType = "NetbootSquashfs"
+	ArtifactNetbootScript  ArtifactType = "NetbootScript"
+	ArtifactContainerImage ArtifactType = "ContainerImage"
+	ArtifactChecksum       ArtifactType = "Checksum"
+	ArtifactManifest       ArtifactType = "Manifest"
+	ArtifactSignature      ArtifactType = "Signature"
+	ArtifactOther          ArtifactType = "Other"
+)
+
+// ArtifactFile describes a file on the artifacts volume.
+type ArtifactFile struct {
+	// Name is the path of the file relative to the root of the volume.
+	Name string `json:"name"`
+	// Type tells what kind of artifact the file is.
+	Type ArtifactType `json:"type"`
+	// Size of the file in bytes.
+	Size int64 `json:"size"`
+	// SHA256 is the hex encoded sha256 digest of the file. It is empty for
+	// the checksum, signature and manifest files, which are not listed in
+	// SHA256SUMS.
+	// +optional
+	SHA256 string `json:"sha256,omitempty"`
+	// Signature is the name of the detached signature of the file.
+	// +optional
+	Signature string `json:"signature,omitempty"`
+	// URLs lists where exporters published the file.
+	// +optional
+	URLs []string `json:"urls,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 // +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.reason`,priority=1
+// +kubebuilder:printcolumn:name="Queue",type=integer,JSONPath=`.status.queuePosition`,priority=1
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // OSArtifact is the Schema for the osartifacts API
 type OSArtifact struct {
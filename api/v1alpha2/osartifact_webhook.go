@@ -0,0 +1,491 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+const (
+	// DefaultVolumeSize is the storage requested for the artifacts volume
+	// when spec.volume is not set.
+	DefaultVolumeSize = "10Gi"
+	// DefaultCloudConfigKey is the Secret key read when
+	// spec.cloudConfigRef.key is not set.
+	DefaultCloudConfigKey = "userdata"
+	// DefaultCAKey is the Secret key read when spec.push.caRef.key is not
+	// set.
+	DefaultCAKey = "ca.crt"
+	// DefaultCosignKey and DefaultGPGKey are the Secret keys read when
+	// spec.signing.keyRef.key is not set.
+	DefaultCosignKey = "cosign.key"
+	DefaultGPGKey    = "gpg.key"
+	// DefaultRetryBackoff is the wait before retrying a failed build when
+	// spec.retryPolicy.backoff is not set.
+	DefaultRetryBackoff = 30 * time.Second
+)
+
+// SetupWebhookWithManager registers the OSArtifact admission webhooks.
+// toolImage is the default for spec.toolImage.
+func (r *OSArtifact) SetupWebhookWithManager(mgr ctrl.Manager, toolImage string) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		WithDefaulter(&OSArtifactDefaulter{ToolImage: toolImage}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-build-kairos-io-v1alpha2-osartifact,mutating=true,failurePolicy=fail,sideEffects=None,groups=build.kairos.io,resources=osartifacts,verbs=create;update,versions=v1alpha2,name=mosartifact.kb.io,admissionReviewVersions=v1
+
+// OSArtifactDefaulter fills in the OSArtifact spec on admission, so the
+// effective spec is visible on the object itself.
+// +kubebuilder:object:generate=false
+type OSArtifactDefaulter struct {
+	// ToolImage is the default for spec.toolImage.
+	ToolImage string
+}
+
+var _ webhook.CustomDefaulter = &OSArtifactDefaulter{}
+
+// Default implements webhook.CustomDefaulter
+func (d *OSArtifactDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	artifact, ok := obj.(*OSArtifact)
+	if !ok {
+		return fmt.Errorf("expected an OSArtifact but got a %T", obj)
+	}
+
+	artifact.Spec.Default(d.ToolImage)
+	return nil
+}
+
+// Default sets every unset field of the spec to the value the controller
+// assumes for it. toolImage is used when spec.toolImage is empty.
+func (s *OSArtifactSpec) Default(toolImage string) {
+	if s.ToolImage == "" {
+		s.ToolImage = toolImage
+	}
+
+	if s.RebuildPolicy == "" {
+		s.RebuildPolicy = RebuildOnSpecChange
+	}
+
+	if s.CleanupPolicy == "" {
+		s.CleanupPolicy = CleanupKeep
+	}
+
+	if s.VolumeReclaimPolicy == "" {
+		s.VolumeReclaimPolicy = VolumeReclaimDelete
+	}
+
+	if s.Volume == nil {
+		s.Volume = &corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{
+				corev1.ReadWriteOnce,
+			},
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: resource.MustParse(DefaultVolumeSize),
+				},
+			},
+		}
+	}
+
+	if s.RetryPolicy != nil {
+		s.RetryPolicy.Default()
+	}
+
+	for i := range s.Exporters {
+		if s.Exporters[i].S3 != nil {
+			s.Exporters[i].S3.Default()
+		}
+	}
+
+	if s.Push != nil && s.Push.CARef != nil && s.Push.CARef.Key == "" {
+		s.Push.CARef.Key = DefaultCAKey
+	}
+	if s.OCIArtifact != nil && s.OCIArtifact.CARef != nil && s.OCIArtifact.CARef.Key == "" {
+		s.OCIArtifact.CARef.Key = DefaultCAKey
+	}
+
+	if s.Signing != nil {
+		s.Signing.Default()
+	}
+
+	if s.CloudConfigRef != nil && s.CloudConfigRef.Key == "" {
+		s.CloudConfigRef.Key = DefaultCloudConfigKey
+	}
+
+	// Netboot artifacts are extracted from the ISO, which is always built.
+	if s.Netboot {
+		s.ISO = true
+	}
+}
+
+// Default sets the key of the Secret read for the signing method.
+func (s *SigningSpec) Default() {
+	if s.KeyRef.Key != "" {
+		return
+	}
+	switch s.Method {
+	case SigningCosign:
+		s.KeyRef.Key = DefaultCosignKey
+	case SigningGPG:
+		s.KeyRef.Key = DefaultGPGKey
+	}
+}
+
+// Default sets the unset fields of the retry policy.
+func (p *RetryPolicy) Default() {
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = 1
+	}
+	if p.Backoff == nil {
+		p.Backoff = &metav1.Duration{Duration: DefaultRetryBackoff}
+	}
+	if len(p.RetryOn) == 0 {
+		p.RetryOn = []RetryableFailure{ReasonEvicted, ReasonResolutionFailed}
+	}
+}
+
+//+kubebuilder:webhook:path=/validate-build-kairos-io-v1alpha2-osartifact,mutating=false,failurePolicy=fail,sideEffects=None,groups=build.kairos.io,resources=osartifacts,verbs=create;update,versions=v1alpha2,name=vosartifact.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &OSArtifact{}
+
+// ValidateCreate implements webhook.Validator
+func (r *OSArtifact) ValidateCreate() error {
+	return r.validate()
+}
+
+// ValidateUpdate implements webhook.Validator
+func (r *OSArtifact) ValidateUpdate(old runtime.Object) error {
+	oldArtifact, ok := old.(*OSArtifact)
+	if !ok {
+		return fmt.Errorf("expected an OSArtifact but got a %T", old)
+	}
+
+	// Objects created before the defaulting webhook was installed may lack
+	// defaults the new object just received, which is not a change.
+	oldSpec := oldArtifact.Spec.DeepCopy()
+	oldSpec.Default(r.Spec.ToolImage)
+
+	// The controller adds and removes its finalizer without touching the
+	// spec, which rules added after the object was created must not block.
+	if r.DeletionTimestamp != nil || equality.Semantic.DeepEqual(*oldSpec, r.Spec) {
+		return nil
+	}
+
+	if oldArtifact.Spec.RebuildPolicy == RebuildNever &&
+		!equality.Semantic.DeepEqual(oldSpec.BuildInputs(), r.Spec.BuildInputs()) {
+		return apierrors.NewInvalid(GroupVersion.WithKind("OSArtifact").GroupKind(), r.Name, field.ErrorList{
+			field.Forbidden(field.NewPath("spec"), "only fields that do not change the build may be updated when rebuildPolicy is Never"),
+		})
+	}
+
+	// Only report what the update broke, fields that were already invalid
+	// are left as they are.
+	existing := map[string]bool{}
+	for _, err := range oldSpec.validate(field.NewPath("spec")) {
+		existing[string(err.Type)+err.Field] = true
+	}
+	var allErrs field.ErrorList
+	for _, err := range r.Spec.validate(field.NewPath("spec")) {
+		if !existing[string(err.Type)+err.Field] {
+			allErrs = append(allErrs, err)
+		}
+	}
+	if len(allErrs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(GroupVersion.WithKind("OSArtifact").GroupKind(), r.Name, allErrs)
+}
+
+// ValidateDelete implements webhook.Validator
+func (r *OSArtifact) ValidateDelete() error {
+	return nil
+}
+
+func (r *OSArtifact) validate() error {
+	allErrs := r.Spec.validate(field.NewPath("spec"))
+	if len(allErrs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(GroupVersion.WithKind("OSArtifact").GroupKind(), r.Name, allErrs)
+}
+
+func (s *OSArtifactSpec) validate(path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	// Only one way of providing the base image is honoured by the builder
+	// pod, see newBuilderPod. imageName may accompany a base image, in which
+	// case it names the resulting Kairos image.
+	if s.ImageName == "" && s.BaseImageName == "" && s.BaseImageDockerfile == nil {
+		allErrs = append(allErrs, field.Required(path.Child("imageName"),
+			"one of imageName, baseImageName or baseImageDockerfile must be set"))
+	}
+	if s.BaseImageName != "" && s.BaseImageDockerfile != nil {
+		allErrs = append(allErrs, field.Forbidden(path.Child("baseImageDockerfile"),
+			"may not be set together with baseImageName"))
+	}
+	if s.BaseImageDockerfile != nil {
+		// The whole Secret is mounted as the kaniko build context, which
+		// expects the Dockerfile under its default name.
+		if key := s.BaseImageDockerfile.Key; key != "" && key != "Dockerfile" {
+			allErrs = append(allErrs, field.NotSupported(path.Child("baseImageDockerfile", "key"),
+				key, []string{"Dockerfile"}))
+		}
+	}
+
+	// azure.sh and gce.sh convert the .raw image produced by build-cloud-image.
+	if s.AzureImage && !s.CloudImage {
+		allErrs = append(allErrs, field.Invalid(path.Child("azureImage"), s.AzureImage,
+			"requires cloudImage, the Azure image is converted from the raw cloud image"))
+	}
+	if s.GCEImage && !s.CloudImage {
+		allErrs = append(allErrs, field.Invalid(path.Child("gceImage"), s.GCEImage,
+			"requires cloudImage, the GCE image is converted from the raw cloud image"))
+	}
+
+	if s.DiskSize != "" {
+		if size, err := strconv.ParseUint(s.DiskSize, 10, 64); err != nil || size == 0 {
+			allErrs = append(allErrs, field.Invalid(path.Child("diskSize"), s.DiskSize,
+				"must be a positive number of megabytes"))
+		}
+	}
+
+	// netboot.sh extracts the kernel, initrd and squashfs from the ISO and
+	// writes an iPXE script pointing at netbootURL.
+	if s.Netboot {
+		if s.NetbootURL == "" {
+			allErrs = append(allErrs, field.Required(path.Child("netbootURL"),
+				"netboot artifacts are served from this URL"))
+		} else if u, err := url.Parse(s.NetbootURL); err != nil || !u.IsAbs() || u.Host == "" {
+			allErrs = append(allErrs, field.Invalid(path.Child("netbootURL"), s.NetbootURL,
+				"must be an absolute URL"))
+		}
+	}
+
+	// The cleanup would delete the volume the reclaim policy asks to keep.
+	if s.CleanupPolicy == CleanupDeleteVolume &&
+		(s.VolumeReclaimPolicy == VolumeReclaimRetain || s.VolumeReclaimPolicy == VolumeReclaimOrphan) {
+		allErrs = append(allErrs, field.Invalid(path.Child("cleanupPolicy"), s.CleanupPolicy,
+			fmt.Sprintf("may not delete the volume that volumeReclaimPolicy %s keeps", s.VolumeReclaimPolicy)))
+	}
+
+	if s.RetryPolicy != nil && s.RetryPolicy.Backoff != nil && s.RetryPolicy.Backoff.Duration < 0 {
+		allErrs = append(allErrs, field.Invalid(path.Child("retryPolicy", "backoff"), s.RetryPolicy.Backoff.Duration.String(),
+			"must not be negative"))
+	}
+
+	if s.BuildTimeout != nil && s.BuildTimeout.Duration < time.Second {
+		allErrs = append(allErrs, field.Invalid(path.Child("buildTimeout"), s.BuildTimeout.Duration.String(),
+			"must be at least one second"))
+	}
+	if s.ExportTimeout != nil && s.ExportTimeout.Duration < time.Second {
+		allErrs = append(allErrs, field.Invalid(path.Child("exportTimeout"), s.ExportTimeout.Duration.String(),
+			"must be at least one second"))
+	}
+
+	if s.Push != nil {
+		allErrs = append(allErrs, s.Push.validate(path.Child("push"))...)
+	}
+	if s.OCIArtifact != nil {
+		allErrs = append(allErrs, s.OCIArtifact.PushSpec.validate(path.Child("ociArtifact"))...)
+	}
+	if s.Signing != nil {
+		allErrs = append(allErrs, s.Signing.validate(path.Child("signing"))...)
+	}
+
+	for i := range s.Exporters {
+		allErrs = append(allErrs, s.Exporters[i].validate(path.Child("exporters").Index(i))...)
+	}
+	allErrs = append(allErrs, validateExporterDependencies(s.Exporters, path.Child("exporters"))...)
+
+	for i, bundle := range s.Bundles {
+		if bundle == "" {
+			allErrs = append(allErrs, field.Required(path.Child("bundles").Index(i), "bundle image must not be empty"))
+		}
+	}
+
+	return allErrs
+}
+
+var (
+	// imageReferencePattern loosely matches a registry/repository[:tag]
+	// image reference. The registry validates the details on push.
+	imageReferencePattern = regexp.MustCompile(`^[a-zA-Z0-9.-]+(:[0-9]+)?(/[a-z0-9]+([._-]+[a-z0-9]+)*)+(:[\w][\w.-]{0,127})?$`)
+	tagPattern            = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+)
+
+func (p *PushSpec) validate(path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if !imageReferencePattern.MatchString(p.Destination) {
+		allErrs = append(allErrs, field.Invalid(path.Child("destination"), p.Destination,
+			"must be an image reference of the form registry/repository[:tag]"))
+	}
+	for i, tag := range p.Tags {
+		if !tagPattern.MatchString(tag) {
+			allErrs = append(allErrs, field.Invalid(path.Child("tags").Index(i), tag, "must be a valid image tag"))
+		}
+	}
+	if p.Insecure && p.CARef != nil {
+		allErrs = append(allErrs, field.Forbidden(path.Child("caRef"), "may not be set together with insecure"))
+	}
+
+	return allErrs
+}
+
+func (s *SigningSpec) validate(path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if s.Method != SigningCosign && s.Method != SigningGPG {
+		allErrs = append(allErrs, field.NotSupported(path.Child("method"), s.Method,
+			[]string{string(SigningCosign), string(SigningGPG)}))
+	}
+	if s.KeyRef.Name == "" {
+		allErrs = append(allErrs, field.Required(path.Child("keyRef", "name"), "the Secret holding the private key must be set"))
+	}
+
+	return allErrs
+}
+
+func (e *Exporter) validate(path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	hasJob := e.Template != nil
+	if e.S3 == nil && !hasJob {
+		allErrs = append(allErrs, field.Required(path.Child("template"), "either a job template or s3 must be set"))
+	}
+	if e.S3 != nil {
+		if hasJob {
+			allErrs = append(allErrs, field.Forbidden(path.Child("template"), "may not be set together with s3"))
+		}
+		allErrs = append(allErrs, e.S3.validate(path.Child("s3"))...)
+	}
+
+	return allErrs
+}
+
+// minMultipartChunkSize is the smallest part S3 accepts in a multipart upload.
+var minMultipartChunkSize = resource.MustParse("5Mi")
+
+func (e *S3Exporter) validate(path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if e.Bucket == "" {
+		allErrs = append(allErrs, field.Required(path.Child("bucket"), ""))
+	}
+	if _, err := e.ObjectKey(S3PathData{Namespace: "default", Name: "artifact", Generation: 1, File: "artifact.iso", Type: ArtifactISO}); err != nil {
+		allErrs = append(allErrs, field.Invalid(path.Child("path"), e.Path, err.Error()))
+	}
+	if e.Endpoint != "" {
+		if u, err := url.Parse(e.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			allErrs = append(allErrs, field.Invalid(path.Child("endpoint"), e.Endpoint, "must be an http or https URL"))
+		}
+	}
+	if e.MultipartThreshold != nil && e.MultipartThreshold.Sign() <= 0 {
+		allErrs = append(allErrs, field.Invalid(path.Child("multipartThreshold"), e.MultipartThreshold.String(), "must be positive"))
+	}
+	if e.MultipartChunkSize != nil && e.MultipartChunkSize.Cmp(minMultipartChunkSize) < 0 {
+		allErrs = append(allErrs, field.Invalid(path.Child("multipartChunkSize"), e.MultipartChunkSize.String(),
+			"must be at least "+minMultipartChunkSize.String()))
+	}
+
+	return allErrs
+}
+
+// validateExporterDependencies checks that the exporter names are unique and
+// that dependsOn forms a DAG of named exporters.
+func validateExporterDependencies(exporters []Exporter, path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	names := map[string]int{}
+	for i, exporter := range exporters {
+		if exporter.Name == "" {
+			continue
+		}
+		namePath := path.Index(i).Child("name")
+		for _, msg := range validation.IsDNS1123Label(exporter.Name) {
+			allErrs = append(allErrs, field.Invalid(namePath, exporter.Name, msg))
+		}
+		if _, ok := names[exporter.Name]; ok {
+			allErrs = append(allErrs, field.Duplicate(namePath, exporter.Name))
+			continue
+		}
+		names[exporter.Name] = i
+	}
+
+	for i, exporter := range exporters {
+		for j, dependency := range exporter.DependsOn {
+			dependencyPath := path.Index(i).Child("dependsOn").Index(j)
+			if dependency == exporter.Name {
+				allErrs = append(allErrs, field.Invalid(dependencyPath, dependency, "an exporter cannot depend on itself"))
+			} else if _, ok := names[dependency]; !ok {
+				allErrs = append(allErrs, field.NotFound(dependencyPath, dependency))
+			}
+		}
+	}
+	if len(allErrs) > 0 {
+		return allErrs
+	}
+
+	// Depth first search, a dependency still on the stack closes a cycle.
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(exporters))
+	var visit func(i int) bool
+	visit = func(i int) bool {
+		state[i] = visiting
+		for _, dependency := range exporters[i].DependsOn {
+			j := names[dependency]
+			if state[j] == visiting || (state[j] == unvisited && !visit(j)) {
+				return false
+			}
+		}
+		state[i] = visited
+		return true
+	}
+	for i := range exporters {
+		if state[i] == unvisited && !visit(i) {
+			allErrs = append(allErrs, field.Invalid(path.Index(i).Child("dependsOn"), exporters[i].DependsOn,
+				"dependencies must not form a cycle"))
+			break
+		}
+	}
+
+	return allErrs
+}
@@ -0,0 +1,331 @@
+package v1alpha2_test
+
+import (
+	"context"
+	"time"
+
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("OSArtifact webhook", func() {
+	var artifact *osbuilder.OSArtifact
+
+	BeforeEach(func() {
+		artifact = &osbuilder.OSArtifact{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+			Spec: osbuilder.OSArtifactSpec{
+				ImageName: "quay.io/kairos/core-opensuse:latest",
+				ISO:       true,
+			},
+		}
+	})
+
+	causes := func(err error) []string {
+		Expect(apierrors.IsInvalid(err)).To(BeTrue(), "expected an Invalid error, got %v", err)
+		var fields []string
+		for _, cause := range err.(apierrors.APIStatus).Status().Details.Causes {
+			fields = append(fields, cause.Field)
+		}
+		return fields
+	}
+
+	Describe("ValidateCreate", func() {
+		It("accepts a plain ISO build", func() {
+			Expect(artifact.ValidateCreate()).To(Succeed())
+		})
+
+		It("accepts imageName alongside a Dockerfile", func() {
+			artifact.Spec.BaseImageDockerfile = &osbuilder.SecretKeySelector{Name: "dockerfile", Key: "Dockerfile"}
+			Expect(artifact.ValidateCreate()).To(Succeed())
+		})
+
+		It("requires an image source", func() {
+			artifact.Spec.ImageName = ""
+			Expect(causes(artifact.ValidateCreate())).To(ConsistOf("spec.imageName"))
+		})
+
+		It("rejects baseImageName together with baseImageDockerfile", func() {
+			artifact.Spec.BaseImageName = "ubuntu:22.04"
+			artifact.Spec.BaseImageDockerfile = &osbuilder.SecretKeySelector{Name: "dockerfile"}
+			Expect(causes(artifact.ValidateCreate())).To(ConsistOf("spec.baseImageDockerfile"))
+		})
+
+		It("rejects a Dockerfile key kaniko will not find", func() {
+			artifact.Spec.BaseImageDockerfile = &osbuilder.SecretKeySelector{Name: "dockerfile", Key: "Containerfile"}
+			Expect(causes(artifact.ValidateCreate())).To(ConsistOf("spec.baseImageDockerfile.key"))
+		})
+
+		It("rejects Azure and GCE images without a cloud image", func() {
+			artifact.Spec.AzureImage = true
+			artifact.Spec.GCEImage = true
+			Expect(causes(artifact.ValidateCreate())).To(ConsistOf("spec.azureImage", "spec.gceImage"))
+
+			artifact.Spec.CloudImage = true
+			Expect(artifact.ValidateCreate()).To(Succeed())
+		})
+
+		It("rejects an unparsable diskSize", func() {
+			artifact.Spec.CloudImage = true
+			artifact.Spec.DiskSize = "10Gi"
+			Expect(causes(artifact.ValidateCreate())).To(ConsistOf("spec.diskSize"))
+
+			artifact.Spec.DiskSize = "16000"
+			Expect(artifact.ValidateCreate()).To(Succeed())
+		})
+
+		It("requires an absolute netbootURL for netboot", func() {
+			artifact.Spec.Netboot = true
+			Expect(causes(artifact.ValidateCreate())).To(ConsistOf("spec.netbootURL"))
+
+			artifact.Spec.NetbootURL = "artifacts/"
+			Expect(causes(artifact.ValidateCreate())).To(ConsistOf("spec.netbootURL"))
+
+			artifact.Spec.NetbootURL = "http://10.0.0.1/artifacts"
+			Expect(artifact.ValidateCreate()).To(Succeed())
+		})
+
+		It("rejects deleting a volume the reclaim policy keeps", func() {
+			artifact.Spec.CleanupPolicy = osbuilder.CleanupDeleteVolume
+			Expect(artifact.ValidateCreate()).To(Succeed())
+
+			artifact.Spec.VolumeReclaimPolicy = osbuilder.VolumeReclaimRetain
+			Expect(causes(artifact.ValidateCreate())).To(ConsistOf("spec.cleanupPolicy"))
+
+			artifact.Spec.VolumeReclaimPolicy = osbuilder.VolumeReclaimOrphan
+			Expect(causes(artifact.ValidateCreate())).To(ConsistOf("spec.cleanupPolicy"))
+		})
+
+		It("validates the push destination and tags", func() {
+			artifact.Spec.Push = &osbuilder.PushSpec{
+				Destination: "https://registry.example.com/kairos",
+				Tags:        []string{"v1", "-bad"},
+			}
+			Expect(causes(artifact.ValidateCreate())).To(ConsistOf("spec.push.destination", "spec.push.tags[1]"))
+
+			artifact.Spec.Push.Destination = "localhost:5000/kairos/custom:v1"
+			artifact.Spec.Push.Tags = []string{"v1", "latest"}
+			Expect(artifact.ValidateCreate()).To(Succeed())
+		})
+
+		It("validates the OCI artifact destination", func() {
+			artifact.Spec.OCIArtifact = &osbuilder.OCIArtifactSpec{
+				PushSpec: osbuilder.PushSpec{Destination: "oci://localhost:5000/kairos"},
+			}
+			Expect(causes(artifact.ValidateCreate())).To(ConsistOf("spec.ociArtifact.destination"))
+
+			artifact.Spec.OCIArtifact.Destination = "localhost:5000/kairos/iso:v1"
+			Expect(artifact.ValidateCreate()).To(Succeed())
+		})
+
+		It("validates the exporter dependencies", func() {
+			exporter := func(name string, dependsOn ...string) osbuilder.Exporter {
+				e := osbuilder.Exporter{Name: name, DependsOn: dependsOn, Template: &corev1.PodTemplateSpec{}}
+				e.Template.Spec.Containers = []corev1.Container{{Name: "export", Image: "busybox"}}
+				return e
+			}
+
+			artifact.Spec.Exporters = []osbuilder.Exporter{
+				exporter("sign", "sign"),
+				exporter("Upload", "missing"),
+				exporter("sign"),
+			}
+			Expect(causes(artifact.ValidateCreate())).To(ConsistOf(
+				"spec.exporters[0].dependsOn[0]", "spec.exporters[1].name",
+				"spec.exporters[1].dependsOn[0]", "spec.exporters[2].name"))
+
+			artifact.Spec.Exporters = []osbuilder.Exporter{
+				exporter("sign", "notify"),
+				exporter("upload", "sign"),
+				exporter("notify", "upload"),
+			}
+			Expect(causes(artifact.ValidateCreate())).To(ConsistOf("spec.exporters[0].dependsOn"))
+
+			artifact.Spec.Exporters[0].DependsOn = nil
+			Expect(artifact.ValidateCreate()).To(Succeed())
+		})
+
+		It("rejects timeouts shorter than a second", func() {
+			artifact.Spec.BuildTimeout = &metav1.Duration{}
+			artifact.Spec.ExportTimeout = &metav1.Duration{Duration: -time.Minute}
+			Expect(causes(artifact.ValidateCreate())).To(ConsistOf("spec.buildTimeout", "spec.exportTimeout"))
+
+			artifact.Spec.BuildTimeout.Duration = time.Hour
+			artifact.Spec.ExportTimeout.Duration = time.Minute
+			Expect(artifact.ValidateCreate()).To(Succeed())
+		})
+
+		It("validates the S3 exporter", func() {
+			chunk := resource.MustParse("1Mi")
+			artifact.Spec.Exporters = []osbuilder.Exporter{{
+				S3: &osbuilder.S3Exporter{
+					Bucket:             "artifacts",
+					Path:               "{{ .Nam }}/{{ .File }}",
+					Endpoint:           "minio:9000",
+					MultipartChunkSize: &chunk,
+				},
+			}}
+			Expect(causes(artifact.ValidateCreate())).To(ConsistOf(
+				"spec.exporters[0].s3.path", "spec.exporters[0].s3.endpoint", "spec.exporters[0].s3.multipartChunkSize"))
+
+			artifact.Spec.Exporters[0].S3.Path = "{{ .Name }}/{{ .File }}"
+			artifact.Spec.Exporters[0].S3.Endpoint = "http://minio:9000"
+			artifact.Spec.Exporters[0].S3.MultipartChunkSize = nil
+			Expect(artifact.ValidateCreate()).To(Succeed())
+		})
+
+		It("requires exactly one of a job template and s3", func() {
+			artifact.Spec.Exporters = []osbuilder.Exporter{{}}
+			Expect(causes(artifact.ValidateCreate())).To(ConsistOf("spec.exporters[0].template"))
+
+			artifact.Spec.Exporters[0].S3 = &osbuilder.S3Exporter{Bucket: "artifacts"}
+			artifact.Spec.Exporters[0].Template = &corev1.PodTemplateSpec{}
+			artifact.Spec.Exporters[0].Template.Spec.Containers = []corev1.Container{{Name: "upload", Image: "busybox"}}
+			Expect(causes(artifact.ValidateCreate())).To(ConsistOf("spec.exporters[0].template"))
+		})
+
+		It("validates the signing method and key", func() {
+			artifact.Spec.Signing = &osbuilder.SigningSpec{Method: "minisign"}
+			Expect(causes(artifact.ValidateCreate())).To(ConsistOf("spec.signing.method", "spec.signing.keyRef.name"))
+
+			artifact.Spec.Signing = &osbuilder.SigningSpec{
+				Method: osbuilder.SigningGPG,
+				KeyRef: osbuilder.SecretKeySelector{Name: "signing"},
+			}
+			Expect(artifact.ValidateCreate()).To(Succeed())
+		})
+	})
+
+	Describe("ValidateUpdate", func() {
+		var old *osbuilder.OSArtifact
+
+		BeforeEach(func() {
+			old = artifact.DeepCopy()
+		})
+
+		It("only rejects the fields the update broke", func() {
+			old.Spec.DiskSize = "big"
+			artifact.Spec.DiskSize = "big"
+			artifact.Spec.Bundles = []string{""}
+			Expect(causes(artifact.ValidateUpdate(old))).To(ConsistOf("spec.bundles[0]"))
+
+			artifact.Spec.Bundles = []string{"quay.io/kairos/packages:k9s-utils-0.27.4"}
+			Expect(artifact.ValidateUpdate(old)).To(Succeed())
+		})
+
+		It("lets invalid objects gain and lose their finalizer", func() {
+			old.Spec.ImageName = ""
+			artifact.Spec.ImageName = ""
+			artifact.Spec.Default("quay.io/kairos/auroraboot:test")
+			artifact.Finalizers = []string{"build.kairos.io/osbuilder-finalizer"}
+			Expect(artifact.ValidateUpdate(old)).To(Succeed())
+
+			now := metav1.Now()
+			artifact.DeletionTimestamp = &now
+			artifact.Spec.Bundles = []string{""}
+			Expect(artifact.ValidateUpdate(old)).To(Succeed())
+		})
+
+		It("allows spec changes by default", func() {
+			artifact.Spec.Bundles = []string{"quay.io/kairos/packages:k9s-utils-0.27.4"}
+			Expect(artifact.ValidateUpdate(old)).To(Succeed())
+		})
+
+		It("rejects spec changes when rebuildPolicy is Never", func() {
+			old.Spec.RebuildPolicy = osbuilder.RebuildNever
+			artifact.Spec.RebuildPolicy = osbuilder.RebuildNever
+			artifact.Spec.Bundles = []string{"quay.io/kairos/packages:k9s-utils-0.27.4"}
+			Expect(causes(artifact.ValidateUpdate(old))).To(ConsistOf("spec"))
+		})
+
+		It("allows suspending when rebuildPolicy is Never", func() {
+			old.Spec.RebuildPolicy = osbuilder.RebuildNever
+			artifact.Spec.RebuildPolicy = osbuilder.RebuildNever
+			artifact.Spec.Suspend = true
+			artifact.Spec.Default("quay.io/kairos/auroraboot:test")
+			Expect(artifact.ValidateUpdate(old)).To(Succeed())
+		})
+
+		It("does not treat newly applied defaults as a change", func() {
+			old.Spec.RebuildPolicy = osbuilder.RebuildNever
+			artifact.Spec.RebuildPolicy = osbuilder.RebuildNever
+			artifact.Spec.Default("quay.io/kairos/auroraboot:test")
+			Expect(artifact.ValidateUpdate(old)).To(Succeed())
+		})
+	})
+
+	Describe("Default", func() {
+		var defaulter *osbuilder.OSArtifactDefaulter
+
+		BeforeEach(func() {
+			defaulter = &osbuilder.OSArtifactDefaulter{ToolImage: "quay.io/kairos/auroraboot:test"}
+		})
+
+		It("fills in the volume and tool image", func() {
+			Expect(defaulter.Default(context.TODO(), artifact)).To(Succeed())
+
+			Expect(artifact.Spec.ToolImage).To(Equal("quay.io/kairos/auroraboot:test"))
+			Expect(artifact.Spec.CleanupPolicy).To(Equal(osbuilder.CleanupKeep))
+			Expect(artifact.Spec.Volume).ToNot(BeNil())
+			Expect(artifact.Spec.Volume.AccessModes).To(ConsistOf(corev1.ReadWriteOnce))
+			Expect(artifact.Spec.Volume.Resources.Requests.Storage().String()).To(Equal(osbuilder.DefaultVolumeSize))
+		})
+
+		It("keeps values set by the user", func() {
+			artifact.Spec.ToolImage = "example.com/tools:custom"
+			artifact.Spec.CloudConfigRef = &osbuilder.SecretKeySelector{Name: "cloud-config", Key: "config.yaml"}
+			Expect(defaulter.Default(context.TODO(), artifact)).To(Succeed())
+
+			Expect(artifact.Spec.ToolImage).To(Equal("example.com/tools:custom"))
+			Expect(artifact.Spec.CloudConfigRef.Key).To(Equal("config.yaml"))
+		})
+
+		It("defaults the cloud config key", func() {
+			artifact.Spec.CloudConfigRef = &osbuilder.SecretKeySelector{Name: "cloud-config"}
+			Expect(defaulter.Default(context.TODO(), artifact)).To(Succeed())
+
+			Expect(artifact.Spec.CloudConfigRef.Key).To(Equal(osbuilder.DefaultCloudConfigKey))
+		})
+
+		It("defaults the signing key of the method", func() {
+			artifact.Spec.Signing = &osbuilder.SigningSpec{
+				Method: osbuilder.SigningCosign,
+				KeyRef: osbuilder.SecretKeySelector{Name: "signing"},
+			}
+			Expect(defaulter.Default(context.TODO(), artifact)).To(Succeed())
+			Expect(artifact.Spec.Signing.KeyRef.Key).To(Equal(osbuilder.DefaultCosignKey))
+
+			artifact.Spec.Signing = &osbuilder.SigningSpec{
+				Method: osbuilder.SigningGPG,
+				KeyRef: osbuilder.SecretKeySelector{Name: "signing"},
+			}
+			Expect(defaulter.Default(context.TODO(), artifact)).To(Succeed())
+			Expect(artifact.Spec.Signing.KeyRef.Key).To(Equal(osbuilder.DefaultGPGKey))
+		})
+
+		It("builds the ISO netboot artifacts are extracted from", func() {
+			artifact.Spec.ISO = false
+			artifact.Spec.Netboot = true
+			Expect(defaulter.Default(context.TODO(), artifact)).To(Succeed())
+
+			Expect(artifact.Spec.ISO).To(BeTrue())
+		})
+
+		It("completes a partial retry policy", func() {
+			artifact.Spec.RetryPolicy = &osbuilder.RetryPolicy{MaxAttempts: 3}
+			Expect(defaulter.Default(context.TODO(), artifact)).To(Succeed())
+
+			Expect(artifact.Spec.RetryPolicy.MaxAttempts).To(BeEquivalentTo(3))
+			Expect(artifact.Spec.RetryPolicy.Backoff.Duration).To(Equal(osbuilder.DefaultRetryBackoff))
+			Expect(artifact.Spec.RetryPolicy.RetryOn).To(ConsistOf(
+				osbuilder.RetryableFailure(osbuilder.ReasonEvicted),
+				osbuilder.RetryableFailure(osbuilder.ReasonResolutionFailed),
+			))
+		})
+	})
+})
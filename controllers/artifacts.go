@@ -0,0 +1,192 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const reportArtifactsContainerName = "report-artifacts"
+
+// buildSteps are the builder pod containers producing artifacts, the other
+// init containers prepare the rootfs they are built from.
+var buildSteps = map[string]bool{
+	"build-iso":                  true,
+	"build-netboot":              true,
+	"build-cloud-image":          true,
+	"build-azure-cloud-image":    true,
+	"build-gce-cloud-image":      true,
+	"create-image":               true,
+	pushImageContainerName:       true,
+	ociArtifactContainerName:     true,
+	writeChecksumsContainerName:  true,
+	signArtifactsContainerName:   true,
+	signImageContainerName:       true,
+	signOCIArtifactContainerName: true,
+	reportArtifactsContainerName: true,
+}
+
+// maxReportSize is the size of the termination log the kubelet keeps, see
+// corev1.Container.TerminationMessagePath.
+const maxReportSize = 4096
+
+// reportArtifactsScript writes one line per file on the artifacts volume to
+// the termination log, where checkBuild collects it: the sha256 digest
+// write-checksums recorded for the file, or - for the files it does not cover,
+// then the size and the name. A last "# <count>" line tells a complete report
+// from a truncated one. The build fails rather than reporting a partial list.
+var reportArtifactsScript = fmt.Sprintf(`cd /artifacts
+declare -A sums
+while IFS= read -r line; do
+  sums["${line:66}"]="${line:0:64}"
+done < %[1]s
+count=0
+: > /tmp/report
+while IFS= read -r -d '' f; do
+  f=${f#./}
+  if [[ "$f" == *$'\n'* ]]; then
+    printf 'cannot report %%q, its name contains a newline' "$f" > /dev/termination-log
+    exit 1
+  fi
+  printf '%%s %%s %%s\n' "${sums[$f]:--}" "$(stat -c %%s "$f")" "$f" >> /tmp/report
+  count=$((count + 1))
+done < <(find . -type f -print0 | sort -z)
+printf '# %%d\n' "$count" >> /tmp/report
+if [ "$(stat -c %%s /tmp/report)" -gt %[2]d ]; then
+  printf 'cannot report %%d files, the list exceeds the %[2]d bytes of the termination log' "$count" > /dev/termination-log
+  exit 1
+fi
+cp /tmp/report /dev/termination-log
+`, checksumsFile, maxReportSize)
+
+func reportArtifactsContainer(containerImage string) corev1.Container {
+	return corev1.Container{
+		ImagePullPolicy: corev1.PullAlways,
+		Name:            reportArtifactsContainerName,
+		Image:           containerImage,
+		Command:         []string{"/bin/bash", "-cxe"},
+		Args: []string{
+			reportArtifactsScript,
+		},
+		TerminationMessagePolicy: corev1.TerminationMessageReadFile,
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      "artifacts",
+				MountPath: "/artifacts",
+				ReadOnly:  true,
+			},
+		},
+	}
+}
+
+// builtArtifacts reads the files reported by a succeeded builder pod.
+func builtArtifacts(pod *corev1.Pod) ([]osbuilder.ArtifactFile, error) {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name != reportArtifactsContainerName {
+			continue
+		}
+		if status.State.Terminated == nil {
+			return nil, fmt.Errorf("container %s has not terminated", status.Name)
+		}
+
+		files, err := parseArtifactsReport(status.State.Terminated.Message)
+		if err != nil {
+			return nil, fmt.Errorf("parsing the artifacts reported by %s: %w", status.Name, err)
+		}
+
+		return files, nil
+	}
+
+	return nil, fmt.Errorf("builder pod %s has no %s container", pod.Name, reportArtifactsContainerName)
+}
+
+// parseArtifactsReport parses the lines written by reportArtifactsScript.
+func parseArtifactsReport(report string) ([]osbuilder.ArtifactFile, error) {
+	lines := strings.Split(strings.TrimSuffix(report, "\n"), "\n")
+	last := lines[len(lines)-1]
+	if !strings.HasPrefix(last, "# ") {
+		return nil, fmt.Errorf("the report is incomplete")
+	}
+	count, err := strconv.Atoi(strings.TrimPrefix(last, "# "))
+	if err != nil {
+		return nil, fmt.Errorf("invalid file count %q", last)
+	}
+	lines = lines[:len(lines)-1]
+	if count != len(lines) {
+		return nil, fmt.Errorf("expected %d files, got %d", count, len(lines))
+	}
+
+	files := make([]osbuilder.ArtifactFile, 0, count)
+	for _, line := range lines {
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid line %q", line)
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid size in line %q", line)
+		}
+		file := osbuilder.ArtifactFile{
+			Name: fields[2],
+			Type: artifactType(fields[2]),
+			Size: size,
+		}
+		if fields[0] != "-" {
+			file.SHA256 = fields[0]
+		}
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// artifactSuffixes classify files by the name the build scripts give them.
+// The first matching suffix wins.
+var artifactSuffixes = []struct {
+	suffix   string
+	fileType osbuilder.ArtifactType
+}{
+	{".sig", osbuilder.ArtifactSignature},
+	{".asc", osbuilder.ArtifactSignature},
+	{".sha256", osbuilder.ArtifactChecksum},
+	{checksumsFile, osbuilder.ArtifactChecksum},
+	{buildManifestFile, osbuilder.ArtifactManifest},
+	{".iso", osbuilder.ArtifactISO},
+	{".gce.raw", osbuilder.ArtifactGCEImage},
+	{".raw", osbuilder.ArtifactRawImage},
+	{".vhd", osbuilder.ArtifactAzureImage},
+	{"-kernel", osbuilder.ArtifactNetbootKernel},
+	{"-initrd", osbuilder.ArtifactNetbootInitrd},
+	{".squashfs", osbuilder.ArtifactNetbootRootfs},
+	{".ipxe", osbuilder.ArtifactNetbootScript},
+	{".tar", osbuilder.ArtifactContainerImage},
+}
+
+// artifactType classifies a file by the name the build scripts give it.
+func artifactType(name string) osbuilder.ArtifactType {
+	for _, s := range artifactSuffixes {
+		if strings.HasSuffix(name, s.suffix) {
+			return s.fileType
+		}
+	}
+	return osbuilder.ArtifactOther
+}
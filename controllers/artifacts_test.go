@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"context"
+
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Artifacts", func() {
+	var pod *corev1.Pod
+
+	BeforeEach(func() {
+		pod = &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-abcde"},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{
+					Name: reportArtifactsContainerName,
+					State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+						Message: "abc 1024 test.iso\ndef 10 test-kernel\n123 20 my \"image\".gce.raw\n- 70 test.iso.sha256\n# 4\n",
+					}},
+				}},
+			},
+		}
+	})
+
+	Describe("builtArtifacts", func() {
+		It("parses and classifies the reported files", func() {
+			files, err := builtArtifacts(pod)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(files).To(Equal([]osbuilder.ArtifactFile{
+				{Name: "test.iso", Type: osbuilder.ArtifactISO, Size: 1024, SHA256: "abc"},
+				{Name: "test-kernel", Type: osbuilder.ArtifactNetbootKernel, Size: 10, SHA256: "def"},
+				{Name: `my "image".gce.raw`, Type: osbuilder.ArtifactGCEImage, Size: 20, SHA256: "123"},
+				{Name: "test.iso.sha256", Type: osbuilder.ArtifactChecksum, Size: 70},
+			}))
+		})
+
+		It("fails on a truncated report", func() {
+			pod.Status.ContainerStatuses[0].State.Terminated.Message = "abc 1024 test.iso\ndef 10 te"
+			_, err := builtArtifacts(pod)
+			Expect(err).To(HaveOccurred())
+
+			pod.Status.ContainerStatuses[0].State.Terminated.Message = "abc 1024 test.iso\n# 2\n"
+			_, err = builtArtifacts(pod)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("fails the build on a report it cannot parse", func() {
+			artifact := &osbuilder.OSArtifact{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default", Generation: 1},
+			}
+			markBuilding(artifact)
+			startAttempt(artifact, 1, pod)
+
+			pod.Namespace = "default"
+			pod.Labels = map[string]string{artifactLabel: "test", attemptLabel: "1"}
+			pod.Status.Phase = corev1.PodSucceeded
+			pod.Status.ContainerStatuses[0].State.Terminated.Message = "abc 1024 test.iso\n"
+
+			r := &OSArtifactReconciler{Client: newFakeClient(artifact, pod)}
+			_, err := r.checkBuild(context.TODO(), artifact)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(artifact.Status.Phase).To(BeEquivalentTo(osbuilder.Error))
+			Expect(artifact.Status.Reason).To(Equal(osbuilder.ReasonBuildFailed))
+			Expect(artifact.Status.Artifacts).To(BeEmpty())
+		})
+	})
+
+	Describe("newBuilderPod", func() {
+		It("builds the outputs in order before reporting them", func() {
+			r := &OSArtifactReconciler{ToolImage: "quay.io/kairos/auroraboot:latest"}
+			artifact := &osbuilder.OSArtifact{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+				Spec: osbuilder.OSArtifactSpec{
+					ImageName:  "quay.io/kairos/core-opensuse:latest",
+					ISO:        true,
+					Netboot:    true,
+					CloudImage: true,
+					AzureImage: true,
+				},
+			}
+
+			pod := r.newBuilderPod("test-artifacts", artifact)
+
+			var initContainers []string
+			for _, c := range pod.Spec.InitContainers {
+				initContainers = append(initContainers, c.Name)
+			}
+			Expect(initContainers).To(Equal([]string{
+				"pull-image-baseimage",
+				describeSourceContainerName,
+				"build-iso",
+				"build-netboot",
+				"build-cloud-image",
+				"build-azure-cloud-image",
+				"create-image",
+				writeChecksumsContainerName,
+			}))
+			Expect(pod.Spec.Containers).To(HaveLen(1))
+			Expect(pod.Spec.Containers[0].Name).To(Equal(reportArtifactsContainerName))
+		})
+	})
+	Describe("writeChecksumsContainer", func() {
+		It("describes the build inputs in the manifest", func() {
+			artifact := &osbuilder.OSArtifact{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default", Generation: 2},
+				Spec: osbuilder.OSArtifactSpec{
+					ImageName: "quay.io/kairos/core-opensuse:latest",
+					Bundles:   []string{"quay.io/kairos/bundle:latest"},
+				},
+			}
+
+			container := writeChecksumsContainer("quay.io/kairos/auroraboot:latest", artifact)
+			Expect(container.Env).To(ConsistOf(corev1.EnvVar{
+				Name:  "MANIFEST",
+				Value: `{"name":"test","namespace":"default","generation":2,"inputs":{"imageName":"quay.io/kairos/core-opensuse:latest","bundles":["quay.io/kairos/bundle:latest"],"toolImage":"quay.io/kairos/auroraboot:latest"}}`,
+			}))
+		})
+
+		It("classifies the files it writes", func() {
+			Expect(artifactType("test.iso.sha256")).To(Equal(osbuilder.ArtifactChecksum))
+			Expect(artifactType(checksumsFile)).To(Equal(osbuilder.ArtifactChecksum))
+			Expect(artifactType(buildManifestFile)).To(Equal(osbuilder.ArtifactManifest))
+		})
+	})
+})
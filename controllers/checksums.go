@@ -0,0 +1,122 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	writeChecksumsContainerName = "write-checksums"
+
+	checksumsFile     = "SHA256SUMS"
+	buildManifestFile = "manifest.json"
+)
+
+// buildManifest is the part of manifest.json known before the build. The
+// write-checksums container appends the files it found.
+type buildManifest struct {
+	Name       string      `json:"name"`
+	Namespace  string      `json:"namespace"`
+	Generation int64       `json:"generation"`
+	Inputs     buildInputs `json:"inputs"`
+}
+
+// buildInputs are the images a build was made from.
+type buildInputs struct {
+	ImageName     string   `json:"imageName,omitempty"`
+	BaseImageName string   `json:"baseImageName,omitempty"`
+	Bundles       []string `json:"bundles,omitempty"`
+	ToolImage     string   `json:"toolImage"`
+}
+
+// writeChecksumsScript writes a <file>.sha256 next to every built file, then
+// SHA256SUMS and manifest.json at the root of the artifacts volume. The files
+// are classified the same way as in status.artifacts. Signatures left by a
+// previous attempt are skipped, sign-artifacts replaces them. Names that
+// would need escaping in manifest.json or SHA256SUMS fail the build.
+func writeChecksumsScript() string {
+	var script strings.Builder
+	fmt.Fprintf(&script, `cd /artifacts
+rm -f %[1]s %[2]s
+printf '%%s,"files":[' "${MANIFEST%%?}" > /tmp/%[2]s
+: > /tmp/%[1]s
+unsafe='[[:cntrl:]"\\]'
+sep=""
+while IFS= read -r -d '' f; do
+  f=${f#./}
+  if [[ "$f" =~ $unsafe ]]; then
+    printf 'cannot list %%q in the manifest, its name contains a control character, a quote or a backslash' "$f" > /dev/termination-log
+    exit 1
+  fi
+  size=$(stat -c %%s "$f")
+  sum=$(sha256sum "$f" | cut -d' ' -f1)
+  printf '%%s  %%s\n' "$sum" "${f##*/}" > "$f.sha256"
+  printf '%%s  %%s\n' "$sum" "$f" >> /tmp/%[1]s
+  case "$f" in
+`, checksumsFile, buildManifestFile)
+	for _, s := range artifactSuffixes {
+		fmt.Fprintf(&script, "  *%s) type=%s ;;\n", s.suffix, s.fileType)
+	}
+	fmt.Fprintf(&script, `  *) type=%[3]s ;;
+  esac
+  printf '%%s{"name":"%%s","type":"%%s","size":%%s,"sha256":"%%s"}' "$sep" "$f" "$type" "$size" "$sum" >> /tmp/%[2]s
+  sep=","
+done < <(find . -type f ! -name '*.sha256' ! -name '*.sig' ! -name '*.asc' -print0 | sort -z)
+printf ']}' >> /tmp/%[2]s
+mv /tmp/%[1]s /tmp/%[2]s .
+`, checksumsFile, buildManifestFile, osbuilder.ArtifactOther)
+
+	return script.String()
+}
+
+func writeChecksumsContainer(containerImage string, artifact *osbuilder.OSArtifact) corev1.Container {
+	// Marshalling strings cannot fail
+	manifest, _ := json.Marshal(buildManifest{
+		Name:       artifact.Name,
+		Namespace:  artifact.Namespace,
+		Generation: artifact.Generation,
+		Inputs: buildInputs{
+			ImageName:     artifact.Spec.ImageName,
+			BaseImageName: artifact.Spec.BaseImageName,
+			Bundles:       artifact.Spec.Bundles,
+			ToolImage:     containerImage,
+		},
+	})
+
+	return corev1.Container{
+		ImagePullPolicy: corev1.PullAlways,
+		Name:            writeChecksumsContainerName,
+		Image:           containerImage,
+		Command:         []string{"/bin/bash", "-cxe"},
+		Args: []string{
+			writeChecksumsScript(),
+		},
+		Env: []corev1.EnvVar{{Name: "MANIFEST", Value: string(manifest)}},
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      "artifacts",
+				MountPath: "/artifacts",
+			},
+		},
+	}
+}
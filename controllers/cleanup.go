@@ -0,0 +1,238 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// artifactCleanupIndexAnnotation holds the index of the exporter a cleanup
+// job was created for.
+const artifactCleanupIndexAnnotation = "build.kairos.io/cleanup-index"
+
+// jobHasCondition reports whether the job has the condition set to True.
+func jobHasCondition(job *batchv1.Job, condType batchv1.JobConditionType) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == condType && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// runCleanup runs the cleanup jobs of the exporters that ran, before the
+// artifact is deleted. An exporter ran if status.exports records its job, or
+// the job exists because the status was not updated after creating it. It
+// reports whether every cleanup job succeeded.
+func (r *OSArtifactReconciler) runCleanup(ctx context.Context, artifact *osbuilder.OSArtifact) (bool, error) {
+	var jobs batchv1.JobList
+	if err := r.List(ctx, &jobs, &client.ListOptions{
+		Namespace: artifact.Namespace,
+		LabelSelector: labels.SelectorFromSet(labels.Set{
+			artifactLabel: artifact.Name,
+		}),
+	}); err != nil {
+		return false, err
+	}
+
+	exportJobs := map[string]*batchv1.Job{}
+	cleanupJobs := map[string]*batchv1.Job{}
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		if idx, ok := job.Annotations[artifactExporterIndexAnnotation]; ok {
+			exportJobs[idx] = job
+		}
+		if idx, ok := job.Annotations[artifactCleanupIndexAnnotation]; ok {
+			cleanupJobs[idx] = job
+		}
+	}
+
+	pvc, err := r.artifactVolume(ctx, artifact)
+	if err != nil {
+		return false, err
+	}
+
+	cleanups := map[string]*batchv1.JobSpec{}
+	for i, exporter := range artifact.Spec.Exporters {
+		idx := fmt.Sprintf("%d", i)
+		if exporter.Cleanup != nil && (exporterRan(artifact, i) || exportJobs[idx] != nil) {
+			cleanups[idx] = cleanupJobSpec(exporter.Cleanup)
+		}
+	}
+	if r.serves() && (r.wasServed(artifact) || exportJobs[serveIndex] != nil) {
+		cleanups[serveIndex] = r.unserveJobSpec(artifact)
+	}
+
+	var pending, failed []string
+	for idx, spec := range cleanups {
+		job := cleanupJobs[idx]
+		switch {
+		case job == nil:
+			job = newCleanupJob(artifact, idx, spec, pvc)
+			if err := controllerutil.SetOwnerReference(artifact, job, r.Scheme()); err != nil {
+				return false, err
+			}
+			if err := r.Create(ctx, job); err != nil {
+				if apierrors.HasStatusCause(err, corev1.NamespaceTerminatingCause) {
+					// Nothing can run in a namespace being deleted
+					log.FromContext(ctx).Info("Skipping cleanup in a terminating namespace", "exporter", idx)
+					continue
+				}
+				return false, err
+			}
+			pending = append(pending, job.Name)
+		case jobHasCondition(job, batchv1.JobComplete):
+		case jobHasCondition(job, batchv1.JobFailed):
+			failed = append(failed, job.Name)
+		default:
+			pending = append(pending, job.Name)
+		}
+	}
+
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		markDeleting(artifact, osbuilder.ReasonCleanupFailed, fmt.Sprintf(
+			"Cleanup jobs failed: %s. Delete them to try again, or remove the %s finalizer to skip the cleanup",
+			strings.Join(failed, ", "), FinalizerName))
+		return false, nil
+	}
+	if len(pending) > 0 {
+		sort.Strings(pending)
+		markDeleting(artifact, osbuilder.ReasonCleaningUp, fmt.Sprintf(
+			"Waiting for cleanup jobs: %s", strings.Join(pending, ", ")))
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// exporterRan reports whether status.exports records a job for the i-th
+// exporter.
+func exporterRan(artifact *osbuilder.OSArtifact, i int) bool {
+	exports := artifact.Status.Exports
+	return i < len(exports) && exports[i].Name == exporterName(artifact, i) && exports[i].Job != ""
+}
+
+// cleanupJobSpec returns the job running the cleanup container of an
+// exporter.
+func cleanupJobSpec(cleanup *osbuilder.ExporterCleanup) *batchv1.JobSpec {
+	return &batchv1.JobSpec{
+		Template: corev1.PodTemplateSpec{
+			Spec: corev1.PodSpec{
+				RestartPolicy: corev1.RestartPolicyNever,
+				Containers: []corev1.Container{
+					{
+						Name:    "cleanup",
+						Image:   cleanup.Image,
+						Command: cleanup.Command,
+						Args:    cleanup.Args,
+						Env:     cleanup.Env,
+						EnvFrom: cleanup.EnvFrom,
+						VolumeMounts: []corev1.VolumeMount{
+							{
+								Name:      "artifacts",
+								MountPath: "/artifacts",
+								ReadOnly:  true,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// artifactVolume returns the artifacts volume of an artifact, or nil if there
+// is none.
+func (r *OSArtifactReconciler) artifactVolume(ctx context.Context, artifact *osbuilder.OSArtifact) (*corev1.PersistentVolumeClaim, error) {
+	var pvcs corev1.PersistentVolumeClaimList
+	if err := r.List(ctx, &pvcs, &client.ListOptions{
+		Namespace: artifact.Namespace,
+		LabelSelector: labels.SelectorFromSet(labels.Set{
+			artifactLabel: artifact.Name,
+		}),
+	}); err != nil {
+		return nil, err
+	}
+
+	for i := range pvcs.Items {
+		if pvcs.Items[i].DeletionTimestamp == nil {
+			return &pvcs.Items[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+func newCleanupJob(artifact *osbuilder.OSArtifact, idx string, spec *batchv1.JobSpec, pvc *corev1.PersistentVolumeClaim) *batchv1.Job {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-cleanup-%s", artifact.Name, idx),
+			Namespace: artifact.Namespace,
+			Annotations: map[string]string{
+				artifactCleanupIndexAnnotation: idx,
+			},
+			Labels: map[string]string{
+				artifactLabel: artifact.Name,
+			},
+		},
+		Spec: *spec.DeepCopy(),
+	}
+
+	if pvc != nil {
+		job.Spec.Template.Spec.Volumes = append(job.Spec.Template.Spec.Volumes, corev1.Volume{
+			Name: "artifacts",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: pvc.Name,
+					ReadOnly:  true,
+				},
+			},
+		})
+	} else {
+		// The volume is gone, the containers run without it
+		for i := range job.Spec.Template.Spec.Containers {
+			container := &job.Spec.Template.Spec.Containers[i]
+			var mounts []corev1.VolumeMount
+			for _, mount := range container.VolumeMounts {
+				if mount.Name != "artifacts" {
+					mounts = append(mounts, mount)
+				}
+			}
+			container.VolumeMounts = mounts
+		}
+	}
+	applyExporterScheduling(&job.Spec.Template.Spec, artifact)
+	if pvc != nil {
+		colocateWithVolume(&job.Spec.Template.Spec, artifact, pvc)
+	}
+
+	return job
+}
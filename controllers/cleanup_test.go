@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"context"
+
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("Cleanup", func() {
+	var artifact *osbuilder.OSArtifact
+	var r *OSArtifactReconciler
+
+	BeforeEach(func() {
+		artifact = &osbuilder.OSArtifact{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default", UID: "uid"},
+			Spec: osbuilder.OSArtifactSpec{
+				Exporters: []osbuilder.Exporter{
+					{Cleanup: &osbuilder.ExporterCleanup{Image: "amazon/aws-cli"}},
+					{Cleanup: &osbuilder.ExporterCleanup{Image: "amazon/aws-cli"}},
+					{},
+				},
+			},
+		}
+
+		exportJob := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "test-export-0",
+				Namespace:   "default",
+				Labels:      map[string]string{artifactLabel: "test"},
+				Annotations: map[string]string{artifactExporterIndexAnnotation: "0"},
+			},
+		}
+
+		r = &OSArtifactReconciler{Client: newFakeClient(exportJob)}
+	})
+
+	It("waits for the cleanup of the exporters that ran", func() {
+		cleaned, err := r.runCleanup(context.TODO(), artifact)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cleaned).To(BeFalse())
+		Expect(artifact.Status.Phase).To(BeEquivalentTo(osbuilder.Deleting))
+		Expect(artifact.Status.Reason).To(Equal(osbuilder.ReasonCleaningUp))
+		Expect(artifact.Status.Message).To(ContainSubstring("test-cleanup-0"))
+
+		var job batchv1.Job
+		Expect(r.Get(context.TODO(), client.ObjectKey{Namespace: "default", Name: "test-cleanup-0"}, &job)).To(Succeed())
+		Expect(r.Get(context.TODO(), client.ObjectKey{Namespace: "default", Name: "test-cleanup-1"}, &batchv1.Job{})).ToNot(Succeed())
+
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+		Expect(r.Status().Update(context.TODO(), &job)).To(Succeed())
+
+		cleaned, err = r.runCleanup(context.TODO(), artifact)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cleaned).To(BeTrue())
+	})
+
+	It("reports failed cleanup jobs", func() {
+		_, err := r.runCleanup(context.TODO(), artifact)
+		Expect(err).ToNot(HaveOccurred())
+
+		var job batchv1.Job
+		Expect(r.Get(context.TODO(), client.ObjectKey{Namespace: "default", Name: "test-cleanup-0"}, &job)).To(Succeed())
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue}}
+		Expect(r.Status().Update(context.TODO(), &job)).To(Succeed())
+
+		cleaned, err := r.runCleanup(context.TODO(), artifact)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cleaned).To(BeFalse())
+		Expect(artifact.Status.Reason).To(Equal(osbuilder.ReasonCleanupFailed))
+	})
+
+	It("cleans up the exporters status.exports recorded after their jobs are gone", func() {
+		r = &OSArtifactReconciler{Client: newFakeClient()}
+		artifact.Status.Exports = []osbuilder.ExportStatus{
+			{Name: "0", Job: "test-export-0", Phase: osbuilder.ExportSucceeded},
+			{Name: "1", Phase: osbuilder.ExportSkipped},
+			{Name: "2", Job: "test-export-2", Phase: osbuilder.ExportSucceeded},
+		}
+
+		cleaned, err := r.runCleanup(context.TODO(), artifact)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cleaned).To(BeFalse())
+
+		var job batchv1.Job
+		Expect(r.Get(context.TODO(), client.ObjectKey{Namespace: "default", Name: "test-cleanup-0"}, &job)).To(Succeed())
+		Expect(r.Get(context.TODO(), client.ObjectKey{Namespace: "default", Name: "test-cleanup-1"}, &batchv1.Job{})).ToNot(Succeed())
+
+		By("running without the deleted artifacts volume")
+		Expect(job.Spec.Template.Spec.Volumes).To(BeEmpty())
+		Expect(job.Spec.Template.Spec.Containers).To(HaveLen(1))
+		Expect(job.Spec.Template.Spec.Containers[0].Image).To(Equal("amazon/aws-cli"))
+		Expect(job.Spec.Template.Spec.Containers[0].VolumeMounts).To(BeEmpty())
+	})
+})
@@ -0,0 +1,163 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// exporterName returns the name of the i-th exporter, or its index if it has
+// none.
+func exporterName(artifact *osbuilder.OSArtifact, i int) string {
+	if name := artifact.Spec.Exporters[i].Name; name != "" {
+		return name
+	}
+	return fmt.Sprintf("%d", i)
+}
+
+// exporterIndex returns the index of the exporter with the given name, or -1.
+func exporterIndex(artifact *osbuilder.OSArtifact, name string) int {
+	for i, exporter := range artifact.Spec.Exporters {
+		if exporter.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// jobPhase tells whether an exporter job is still running from its Complete
+// and Failed conditions. The message of a failed job explains the failure.
+func jobPhase(job *batchv1.Job) (osbuilder.ExportPhase, string) {
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobComplete:
+			return osbuilder.ExportSucceeded, ""
+		case batchv1.JobFailed:
+			return osbuilder.ExportFailed, fmt.Sprintf("job %s failed: %s", job.Name, condition.Message)
+		}
+	}
+	return osbuilder.ExportRunning, ""
+}
+
+// trackExports returns the status of every exporter, given the exporter jobs
+// by export index. An exporter whose job is gone, for instance deleted by its
+// ttlSecondsAfterFinished, keeps the outcome recorded in status.exports.
+// Exporters depending on a failed or skipped one are skipped.
+func trackExports(artifact *osbuilder.OSArtifact, jobs map[string]*batchv1.Job) []osbuilder.ExportStatus {
+	exports := make([]osbuilder.ExportStatus, len(artifact.Spec.Exporters))
+	for i := range artifact.Spec.Exporters {
+		exports[i] = osbuilder.ExportStatus{Name: exporterName(artifact, i), Phase: osbuilder.ExportPending}
+		if job := jobs[fmt.Sprintf("%d", i)]; job != nil {
+			exports[i].Job = job.Name
+			exports[i].Phase, exports[i].Message = jobPhase(job)
+			exports[i].Attempts = job.Status.Active + job.Status.Succeeded + job.Status.Failed
+		} else if recorded := recordedExport(artifact, i); recorded != nil {
+			exports[i] = *recorded.DeepCopy()
+		}
+	}
+
+	// Each pass settles at least one more level of the DAG.
+	for changed := true; changed; {
+		changed = false
+		for i := range exports {
+			if exports[i].Phase != osbuilder.ExportPending {
+				continue
+			}
+			for _, dependency := range artifact.Spec.Exporters[i].DependsOn {
+				j := exporterIndex(artifact, dependency)
+				if j < 0 {
+					continue
+				}
+				if phase := exports[j].Phase; phase == osbuilder.ExportFailed || phase == osbuilder.ExportSkipped {
+					exports[i].Phase = osbuilder.ExportSkipped
+					exports[i].Message = fmt.Sprintf("dependency %s is %s", dependency, strings.ToLower(string(phase)))
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	return exports
+}
+
+// recordedExport returns the finished outcome of the i-th exporter recorded in
+// status.exports, or nil.
+func recordedExport(artifact *osbuilder.OSArtifact, i int) *osbuilder.ExportStatus {
+	if i >= len(artifact.Status.Exports) {
+		return nil
+	}
+	recorded := &artifact.Status.Exports[i]
+	if recorded.Name != exporterName(artifact, i) || recorded.Job == "" {
+		return nil
+	}
+	switch recorded.Phase {
+	case osbuilder.ExportSucceeded, osbuilder.ExportFailed:
+		return recorded
+	}
+	return nil
+}
+
+// dependenciesSucceeded reports whether every exporter the i-th one depends
+// on succeeded.
+func dependenciesSucceeded(artifact *osbuilder.OSArtifact, i int, exports []osbuilder.ExportStatus) bool {
+	for _, dependency := range artifact.Spec.Exporters[i].DependsOn {
+		j := exporterIndex(artifact, dependency)
+		if j < 0 || exports[j].Phase != osbuilder.ExportSucceeded {
+			// Unknown dependencies are rejected by the webhook.
+			return false
+		}
+	}
+	return true
+}
+
+// canStartExporter reports whether another exporter job may start while
+// running of them have not finished.
+func canStartExporter(artifact *osbuilder.OSArtifact, running int) bool {
+	limit := artifact.Spec.MaxParallelExporters
+	return limit == nil || int32(running) < *limit
+}
+
+// exportNames returns the names of the exporters in the given phase.
+func exportNames(exports []osbuilder.ExportStatus, phase osbuilder.ExportPhase) []string {
+	var names []string
+	for _, export := range exports {
+		if export.Phase == phase {
+			names = append(names, export.Name)
+		}
+	}
+	return names
+}
+
+// exportsFinished reports whether no exporter is left to run. Failed
+// exporters were allowed to fail, the others fail the artifact right away.
+func exportsFinished(exports []osbuilder.ExportStatus) bool {
+	for _, export := range exports {
+		if export.Phase == osbuilder.ExportPending || export.Phase == osbuilder.ExportRunning {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"context"
+
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("Export", func() {
+	var artifact *osbuilder.OSArtifact
+	var r *OSArtifactReconciler
+
+	exporter := func(name string, dependsOn ...string) osbuilder.Exporter {
+		e := osbuilder.Exporter{Name: name, DependsOn: dependsOn, Template: &corev1.PodTemplateSpec{}}
+		e.Template.Spec.Containers = []corev1.Container{{Name: name, Image: "busybox"}}
+		return e
+	}
+
+	exportJobs := func() []string {
+		var jobs batchv1.JobList
+		Expect(r.List(context.TODO(), &jobs)).To(Succeed())
+		var names []string
+		for _, job := range jobs.Items {
+			names = append(names, job.Name)
+		}
+		return names
+	}
+
+	finish := func(name string, condType batchv1.JobConditionType) {
+		var job batchv1.Job
+		Expect(r.Get(context.TODO(), client.ObjectKey{Namespace: "default", Name: name}, &job)).To(Succeed())
+		job.Status.Conditions = append(job.Status.Conditions, batchv1.JobCondition{
+			Type:    condType,
+			Status:  corev1.ConditionTrue,
+			Message: "Job has reached the specified backoff limit",
+		})
+		if condType == batchv1.JobComplete {
+			job.Status.Succeeded = 1
+		} else {
+			job.Status.Failed = 1
+		}
+		Expect(r.Status().Update(context.TODO(), &job)).To(Succeed())
+	}
+	succeed := func(name string) { finish(name, batchv1.JobComplete) }
+
+	BeforeEach(func() {
+		artifact = &osbuilder.OSArtifact{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default", UID: "uid"},
+			Spec: osbuilder.OSArtifactSpec{
+				Exporters: []osbuilder.Exporter{
+					exporter("notify", "upload"),
+					exporter("sign"),
+					exporter("upload", "sign"),
+					exporter("report"),
+				},
+			},
+			Status: osbuilder.OSArtifactStatus{Phase: osbuilder.Exporting},
+		}
+		pvc := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-artifacts",
+				Namespace: "default",
+				Labels:    map[string]string{artifactLabel: "test"},
+			},
+		}
+
+		r = &OSArtifactReconciler{Client: newFakeClient(artifact, pvc)}
+	})
+
+	It("starts the exporters once their dependencies succeeded", func() {
+		_, err := r.checkExport(context.TODO(), artifact)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(exportJobs()).To(ConsistOf("test-export-1", "test-export-3"))
+
+		succeed("test-export-1")
+		_, err = r.checkExport(context.TODO(), artifact)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(exportJobs()).To(ConsistOf("test-export-1", "test-export-2", "test-export-3"))
+
+		succeed("test-export-2")
+		_, err = r.checkExport(context.TODO(), artifact)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(exportJobs()).To(HaveLen(4))
+	})
+
+	It("keeps the outcome of exporters whose job expired", func() {
+		_, err := r.checkExport(context.TODO(), artifact)
+		Expect(err).ToNot(HaveOccurred())
+		succeed("test-export-1")
+		_, err = r.checkExport(context.TODO(), artifact)
+		Expect(err).ToNot(HaveOccurred())
+
+		// Deleted by its ttlSecondsAfterFinished
+		Expect(r.Delete(context.TODO(), &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test-export-1"}})).To(Succeed())
+		_, err = r.checkExport(context.TODO(), artifact)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(exportJobs()).To(ConsistOf("test-export-2", "test-export-3"))
+		Expect(artifact.Status.Exports[1].Phase).To(Equal(osbuilder.ExportSucceeded))
+		Expect(artifact.Status.Exports[1].Job).To(Equal("test-export-1"))
+	})
+
+	It("limits the exporters running at once", func() {
+		artifact.Spec.MaxParallelExporters = ptr(int32(1))
+
+		_, err := r.checkExport(context.TODO(), artifact)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(exportJobs()).To(ConsistOf("test-export-1"))
+
+		succeed("test-export-1")
+		_, err = r.checkExport(context.TODO(), artifact)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(exportJobs()).To(ConsistOf("test-export-1", "test-export-2"))
+	})
+
+	It("fails the artifact when a single completion job fails", func() {
+		_, err := r.checkExport(context.TODO(), artifact)
+		Expect(err).ToNot(HaveOccurred())
+
+		finish("test-export-1", batchv1.JobFailed)
+		_, err = r.checkExport(context.TODO(), artifact)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(artifact.Status.Phase).To(BeEquivalentTo(osbuilder.Error))
+		Expect(artifact.Status.Reason).To(Equal(osbuilder.ReasonExportFailed))
+		Expect(artifact.Status.Message).To(Equal(
+			"exporter sign failed: job test-export-1 failed: Job has reached the specified backoff limit"))
+		Expect(artifact.Status.Exports[1]).To(Equal(osbuilder.ExportStatus{
+			Name:     "sign",
+			Job:      "test-export-1",
+			Phase:    osbuilder.ExportFailed,
+			Attempts: 1,
+			Message:  "job test-export-1 failed: Job has reached the specified backoff limit",
+		}))
+	})
+
+	It("skips the dependents of exporters allowed to fail", func() {
+		artifact.Spec.Exporters[1].AllowFailure = true
+
+		_, err := r.checkExport(context.TODO(), artifact)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(artifact.Status.Exports[1].Phase).To(Equal(osbuilder.ExportRunning))
+		Expect(artifact.Status.Exports[2].Phase).To(Equal(osbuilder.ExportPending))
+
+		finish("test-export-1", batchv1.JobFailed)
+		succeed("test-export-3")
+		_, err = r.checkExport(context.TODO(), artifact)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(artifact.Status.Phase).To(BeEquivalentTo(osbuilder.Ready))
+		Expect(artifact.Status.Message).To(Equal("Exporters allowed to fail failed: sign. Skipped exporters: notify, upload"))
+		var phases []osbuilder.ExportPhase
+		for _, export := range artifact.Status.Exports {
+			phases = append(phases, export.Phase)
+		}
+		Expect(phases).To(Equal([]osbuilder.ExportPhase{
+			osbuilder.ExportSkipped, osbuilder.ExportFailed, osbuilder.ExportSkipped, osbuilder.ExportSucceeded,
+		}))
+		Expect(artifact.Status.Exports[0].Message).To(Equal("dependency upload is skipped"))
+		Expect(exportJobs()).To(ConsistOf("test-export-1", "test-export-3"))
+	})
+
+	It("names exporters by index when they have no name", func() {
+		artifact.Spec.Exporters[1].Name = ""
+		Expect(exporterName(artifact, 0)).To(Equal("notify"))
+		Expect(exporterName(artifact, 1)).To(Equal("1"))
+	})
+})
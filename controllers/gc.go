@@ -0,0 +1,98 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// expiresIn returns how long a finished artifact is kept before it is
+// deleted. ok is false when the artifact is kept forever.
+func expiresIn(artifact *osbuilder.OSArtifact) (remaining time.Duration, ok bool) {
+	ttl := artifact.Spec.TTLSecondsAfterFinished
+	if ttl == nil || artifact.Status.CompletionTime == nil {
+		return 0, false
+	}
+
+	return time.Until(artifact.Status.CompletionTime.Add(time.Duration(*ttl) * time.Second)), true
+}
+
+// checkFinished deletes a Ready or failed artifact once its
+// ttlSecondsAfterFinished expired. Everything else created for the artifact
+// is garbage collected through the owner references.
+func (r *OSArtifactReconciler) checkFinished(ctx context.Context, artifact *osbuilder.OSArtifact) (ctrl.Result, error) {
+	remaining, ok := expiresIn(artifact)
+	if !ok {
+		return ctrl.Result{}, nil
+	}
+	if remaining > 0 {
+		return ctrl.Result{RequeueAfter: remaining}, nil
+	}
+
+	log.FromContext(ctx).Info("Deleting finished artifact", "ttlSecondsAfterFinished", *artifact.Spec.TTLSecondsAfterFinished)
+	if err := r.Delete(ctx, artifact); client.IgnoreNotFound(err) != nil {
+		return ctrl.Result{Requeue: true}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// cleanupAfterExport deletes the builder pods and the artifacts volume of an
+// exported artifact when its cleanup policy asks for it. A volume the reclaim
+// policy keeps is never deleted, the webhook rejects that combination but
+// objects admitted without it may still carry it. It returns a sentence
+// telling what was deleted, empty if nothing was.
+func (r *OSArtifactReconciler) cleanupAfterExport(ctx context.Context, artifact *osbuilder.OSArtifact) (string, error) {
+	if artifact.Spec.CleanupPolicy != osbuilder.CleanupDeleteVolume {
+		return "", nil
+	}
+
+	if err := r.deleteBuilderPods(ctx, artifact); err != nil {
+		return "", err
+	}
+	switch artifact.Spec.VolumeReclaimPolicy {
+	case osbuilder.VolumeReclaimRetain, osbuilder.VolumeReclaimOrphan:
+		return fmt.Sprintf("The builder pod was deleted after the export, the artifacts volume is kept by the %s reclaim policy",
+			artifact.Spec.VolumeReclaimPolicy), nil
+	}
+
+	var pvcs corev1.PersistentVolumeClaimList
+	if err := r.List(ctx, &pvcs, &client.ListOptions{
+		Namespace: artifact.Namespace,
+		LabelSelector: labels.SelectorFromSet(labels.Set{
+			artifactLabel: artifact.Name,
+		}),
+	}); err != nil {
+		return "", err
+	}
+	for i := range pvcs.Items {
+		if err := r.Delete(ctx, &pvcs.Items[i]); client.IgnoreNotFound(err) != nil {
+			return "", err
+		}
+	}
+
+	return "The builder pod and the artifacts volume were deleted after the export", nil
+}
@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("Garbage collection", func() {
+	It("expires finished artifacts after their TTL", func() {
+		artifact := &osbuilder.OSArtifact{}
+		_, ok := expiresIn(artifact)
+		Expect(ok).To(BeFalse())
+
+		artifact.Spec.TTLSecondsAfterFinished = ptr(int32(3600))
+		_, ok = expiresIn(artifact)
+		Expect(ok).To(BeFalse(), "the artifact is not finished yet")
+
+		artifact.Status.CompletionTime = &metav1.Time{Time: time.Now().Add(-30 * time.Minute)}
+		remaining, ok := expiresIn(artifact)
+		Expect(ok).To(BeTrue())
+		Expect(remaining).To(BeNumerically("~", 30*time.Minute, time.Minute))
+
+		artifact.Spec.TTLSecondsAfterFinished = ptr(int32(0))
+		remaining, _ = expiresIn(artifact)
+		Expect(remaining).To(BeNumerically("<", 0))
+	})
+
+	It("expires suspended finished artifacts", func() {
+		completed := metav1.NewTime(time.Now().Add(-time.Hour))
+		artifact := &osbuilder.OSArtifact{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       "test",
+				Namespace:  "default",
+				Generation: 1,
+				Finalizers: []string{FinalizerName},
+			},
+			Spec: osbuilder.OSArtifactSpec{
+				Suspend:                 true,
+				TTLSecondsAfterFinished: ptr(int32(60)),
+			},
+			Status: osbuilder.OSArtifactStatus{
+				Phase:              osbuilder.Ready,
+				ObservedGeneration: 1,
+				CompletionTime:     &completed,
+			},
+		}
+		r := &OSArtifactReconciler{Client: newFakeClient(artifact)}
+
+		_, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(artifact)})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(r.Get(context.TODO(), client.ObjectKeyFromObject(artifact), artifact)).To(Succeed())
+		Expect(artifact.DeletionTimestamp).ToNot(BeNil())
+		Expect(artifact.Status.Phase).To(BeEquivalentTo(osbuilder.Ready))
+	})
+
+	It("keeps a volume the reclaim policy retains after the export", func() {
+		artifact := &osbuilder.OSArtifact{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+			Spec: osbuilder.OSArtifactSpec{
+				CleanupPolicy:       osbuilder.CleanupDeleteVolume,
+				VolumeReclaimPolicy: osbuilder.VolumeReclaimRetain,
+			},
+		}
+		labelled := func(name string) metav1.ObjectMeta {
+			return metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{artifactLabel: "test"}}
+		}
+		r := &OSArtifactReconciler{Client: newFakeClient(
+			&corev1.Pod{ObjectMeta: labelled("test-build-1-1")},
+			&corev1.PersistentVolumeClaim{ObjectMeta: labelled("test-artifacts")},
+		)}
+
+		cleaned, err := r.cleanupAfterExport(context.TODO(), artifact)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cleaned).To(ContainSubstring("the artifacts volume is kept"))
+
+		var pods corev1.PodList
+		Expect(r.List(context.TODO(), &pods)).To(Succeed())
+		Expect(pods.Items).To(BeEmpty())
+		var pvcs corev1.PersistentVolumeClaimList
+		Expect(r.List(context.TODO(), &pvcs)).To(Succeed())
+		Expect(pvcs.Items).To(HaveLen(1))
+	})
+})
@@ -19,7 +19,6 @@ package controllers
 import (
 	"fmt"
 
-	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
@@ -130,19 +129,17 @@ func kairosReleaseContainer(containerImage string) corev1.Container {
 	}
 }
 
+// withDefaults returns a copy of the artifact with the spec defaults applied.
+// Artifacts admitted through the defaulting webhook already carry them, so
+// this only matters when webhooks are disabled.
+func (r *OSArtifactReconciler) withDefaults(artifact *osbuilder.OSArtifact) *osbuilder.OSArtifact {
+	artifact = artifact.DeepCopy()
+	artifact.Spec.Default(r.ToolImage)
+	return artifact
+}
+
 func (r *OSArtifactReconciler) newArtifactPVC(artifact *osbuilder.OSArtifact) *corev1.PersistentVolumeClaim {
-	if artifact.Spec.Volume == nil {
-		artifact.Spec.Volume = &corev1.PersistentVolumeClaimSpec{
-			AccessModes: []corev1.PersistentVolumeAccessMode{
-				corev1.ReadWriteOnce,
-			},
-			Resources: corev1.ResourceRequirements{
-				Requests: map[corev1.ResourceName]resource.Quantity{
-					"storage": resource.MustParse("10Gi"),
-				},
-			},
-		}
-	}
+	artifact = r.withDefaults(artifact)
 
 	pvc := &corev1.PersistentVolumeClaim{
 		ObjectMeta: metav1.ObjectMeta{
@@ -156,6 +153,9 @@ func (r *OSArtifactReconciler) newArtifactPVC(artifact *osbuilder.OSArtifact) *c
 }
 
 func (r *OSArtifactReconciler) newBuilderPod(pvcName string, artifact *osbuilder.OSArtifact) *corev1.Pod {
+	artifact = r.withDefaults(artifact)
+	toolImage := artifact.Spec.ToolImage
+
 	cmd := fmt.Sprintf(
 		"auroraboot --debug build-iso --name %s --date=false --output /artifacts dir:/rootfs",
 		artifact.Name,
@@ -206,7 +206,7 @@ func (r *OSArtifactReconciler) newBuilderPod(pvcName string, artifact *osbuilder
 		ImagePullPolicy: corev1.PullAlways,
 		SecurityContext: &corev1.SecurityContext{Privileged: ptr(true)},
 		Name:            "build-iso",
-		Image:           r.ToolImage,
+		Image:           toolImage,
 		Command:         []string{"/bin/bash", "-cxe"},
 		Args: []string{
 			cmd,
@@ -218,7 +218,7 @@ func (r *OSArtifactReconciler) newBuilderPod(pvcName string, artifact *osbuilder
 		ImagePullPolicy: corev1.PullAlways,
 		SecurityContext: &corev1.SecurityContext{Privileged: ptr(true)},
 		Name:            "build-cloud-image",
-		Image:           r.ToolImage,
+		Image:           toolImage,
 
 		Command: []string{"/bin/bash", "-cxe"},
 		Args: []string{
@@ -238,7 +238,7 @@ func (r *OSArtifactReconciler) newBuilderPod(pvcName string, artifact *osbuilder
 		ImagePullPolicy: corev1.PullAlways,
 		SecurityContext: &corev1.SecurityContext{Privileged: ptr(true)},
 		Name:            "build-netboot",
-		Image:           r.ToolImage,
+		Image:           toolImage,
 		Command:         []string{"/bin/bash", "-cxe"},
 		Env: []corev1.EnvVar{{
 			Name:  "URL",
@@ -258,7 +258,7 @@ func (r *OSArtifactReconciler) newBuilderPod(pvcName string, artifact *osbuilder
 		ImagePullPolicy: corev1.PullAlways,
 		SecurityContext: &corev1.SecurityContext{Privileged: ptr(true)},
 		Name:            "build-azure-cloud-image",
-		Image:           r.ToolImage,
+		Image:           toolImage,
 		Command:         []string{"/bin/bash", "-cxe"},
 		Args: []string{
 			fmt.Sprintf(
@@ -274,7 +274,7 @@ func (r *OSArtifactReconciler) newBuilderPod(pvcName string, artifact *osbuilder
 		ImagePullPolicy: corev1.PullAlways,
 		SecurityContext: &corev1.SecurityContext{Privileged: ptr(true)},
 		Name:            "build-gce-cloud-image",
-		Image:           r.ToolImage,
+		Image:           toolImage,
 		Command:         []string{"/bin/bash", "-cxe"},
 		Args: []string{
 			fmt.Sprintf(
@@ -289,6 +289,7 @@ func (r *OSArtifactReconciler) newBuilderPod(pvcName string, artifact *osbuilder
 	podSpec := corev1.PodSpec{
 		AutomountServiceAccountToken: ptr(false),
 		RestartPolicy:                corev1.RestartPolicyNever,
+		ActiveDeadlineSeconds:        activeDeadlineSeconds(artifact.Spec.BuildTimeout),
 		Volumes: []corev1.Volume{
 			{
 				Name: "artifacts",
@@ -340,6 +341,7 @@ func (r *OSArtifactReconciler) newBuilderPod(pvcName string, artifact *osbuilder
 	}
 
 	podSpec.ImagePullSecrets = append(podSpec.ImagePullSecrets, artifact.Spec.ImagePullSecrets...)
+	applyScheduling(&podSpec, artifact.Spec.Builder)
 
 	podSpec.InitContainers = []corev1.Container{}
 	// Base image can be:
@@ -350,9 +352,9 @@ func (r *OSArtifactReconciler) newBuilderPod(pvcName string, artifact *osbuilder
 		podSpec.InitContainers = append(podSpec.InitContainers, baseImageBuildContainers()...)
 	} else if artifact.Spec.BaseImageName != "" { // Existing base image - non kairos
 		podSpec.InitContainers = append(podSpec.InitContainers,
-			unpackContainer("baseimage-non-kairos", r.ToolImage, artifact.Spec.BaseImageName))
+			unpackContainer("baseimage-non-kairos", toolImage, artifact.Spec.BaseImageName))
 	} else { // Existing Kairos base image
-		podSpec.InitContainers = append(podSpec.InitContainers, unpackContainer("baseimage", r.ToolImage, artifact.Spec.ImageName))
+		podSpec.InitContainers = append(podSpec.InitContainers, unpackContainer("baseimage", toolImage, artifact.Spec.ImageName))
 	}
 
 	// If base image was a non kairos one, either one we built with kaniko or prebuilt,
@@ -375,37 +377,73 @@ func (r *OSArtifactReconciler) newBuilderPod(pvcName string, artifact *osbuilder
 	}
 
 	for i, bundle := range artifact.Spec.Bundles {
-		podSpec.InitContainers = append(podSpec.InitContainers, unpackContainer(fmt.Sprint(i), r.ToolImage, bundle))
+		podSpec.InitContainers = append(podSpec.InitContainers, unpackContainer(fmt.Sprint(i), toolImage, bundle))
 	}
 
 	if artifact.Spec.OSRelease != "" {
-		podSpec.InitContainers = append(podSpec.InitContainers, osReleaseContainer(r.ToolImage))
+		podSpec.InitContainers = append(podSpec.InitContainers, osReleaseContainer(toolImage))
 	}
 	if artifact.Spec.KairosRelease != "" {
-		podSpec.InitContainers = append(podSpec.InitContainers, kairosReleaseContainer(r.ToolImage))
+		podSpec.InitContainers = append(podSpec.InitContainers, kairosReleaseContainer(toolImage))
 	}
 
-	if artifact.Spec.ISO || artifact.Spec.Netboot {
-		podSpec.Containers = append(podSpec.Containers, buildIsoContainer)
+	podSpec.InitContainers = append(podSpec.InitContainers, describeSourceContainer(r.pushImage(), artifact))
+
+	// Build steps run in order, as netboot artifacts are extracted from the
+	// ISO and Azure and GCE images are converted from the raw image.
+	if artifact.Spec.ISO {
+		podSpec.InitContainers = append(podSpec.InitContainers, buildIsoContainer)
 	}
 
 	if artifact.Spec.Netboot {
-		podSpec.Containers = append(podSpec.Containers, extractNetboot)
+		podSpec.InitContainers = append(podSpec.InitContainers, extractNetboot)
 	}
 
 	if artifact.Spec.CloudImage {
-		podSpec.Containers = append(podSpec.Containers, buildCloudImageContainer)
+		podSpec.InitContainers = append(podSpec.InitContainers, buildCloudImageContainer)
 	}
 
 	if artifact.Spec.AzureImage {
-		podSpec.Containers = append(podSpec.Containers, buildAzureCloudImageContainer)
+		podSpec.InitContainers = append(podSpec.InitContainers, buildAzureCloudImageContainer)
 	}
 
 	if artifact.Spec.GCEImage {
-		podSpec.Containers = append(podSpec.Containers, buildGCECloudImageContainer)
+		podSpec.InitContainers = append(podSpec.InitContainers, buildGCECloudImageContainer)
+	}
+
+	podSpec.InitContainers = append(podSpec.InitContainers, createImageContainer(toolImage, artifact))
+	podSpec.InitContainers = append(podSpec.InitContainers, writeChecksumsContainer(toolImage, artifact))
+
+	signing := artifact.Spec.Signing
+	if signing != nil {
+		podSpec.InitContainers = append(podSpec.InitContainers, signArtifactsContainer(r.signingImage(signing.Method), signing))
+		podSpec.Volumes = append(podSpec.Volumes, signingVolumes(signing, signsImages(artifact))...)
+	}
+
+	if artifact.Spec.Push != nil {
+		podSpec.InitContainers = append(podSpec.InitContainers, pushImageContainer(r.pushImage(), artifact))
+		podSpec.Volumes = append(podSpec.Volumes, pushVolumes("push", artifact.Spec.Push)...)
+	}
+	if signsImages(artifact) && artifact.Spec.Push != nil {
+		push := &podSpec.InitContainers[len(podSpec.InitContainers)-1]
+		push.VolumeMounts = append(push.VolumeMounts, pushedMount("push"))
+		podSpec.InitContainers = append(podSpec.InitContainers, signImageContainer(signImageContainerName,
+			r.signingImage(signing.Method), "push", artifact.Spec.Push, signing))
+	}
+
+	if artifact.Spec.OCIArtifact != nil {
+		podSpec.InitContainers = append(podSpec.InitContainers, ociArtifactContainer(r.orasImage(), artifact))
+		podSpec.Volumes = append(podSpec.Volumes, pushVolumes("oci", &artifact.Spec.OCIArtifact.PushSpec)...)
+	}
+	if signsImages(artifact) && artifact.Spec.OCIArtifact != nil {
+		push := &podSpec.InitContainers[len(podSpec.InitContainers)-1]
+		push.VolumeMounts = append(push.VolumeMounts, pushedMount("oci"))
+		podSpec.InitContainers = append(podSpec.InitContainers, signImageContainer(signOCIArtifactContainerName,
+			r.signingImage(signing.Method), "oci", &artifact.Spec.OCIArtifact.PushSpec, signing))
 	}
 
-	podSpec.Containers = append(podSpec.Containers, createImageContainer(r.ToolImage, artifact))
+	podSpec.Containers = append(podSpec.Containers, reportArtifactsContainer(toolImage))
+	r.applyResources(&podSpec, artifact)
 
 	return &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
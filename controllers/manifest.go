@@ -0,0 +1,181 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// exportManifestKey is the key of the export manifest in its ConfigMap.
+	exportManifestKey = "manifest.json"
+	// exportManifestDir is where the export manifest is mounted in the
+	// exporter containers.
+	exportManifestDir = "/osbuilder"
+)
+
+// artifactManifest describes the built artifact to the exporters.
+type artifactManifest struct {
+	Name       string         `json:"name"`
+	Namespace  string         `json:"namespace"`
+	Generation int64          `json:"generation"`
+	Files      []manifestFile `json:"files"`
+	// Source is omitted when the builder pod could not describe it.
+	Source *osbuilder.SourceStatus `json:"source,omitempty"`
+}
+
+// manifestFile is a file of the artifacts volume.
+type manifestFile struct {
+	osbuilder.ArtifactFile `json:",inline"`
+	// Path is where the file is mounted in the exporter containers.
+	Path string `json:"path"`
+}
+
+func exportManifestName(artifact *osbuilder.OSArtifact) string {
+	return fmt.Sprintf("%s-export-manifest", artifact.Name)
+}
+
+func newArtifactManifest(artifact *osbuilder.OSArtifact) artifactManifest {
+	manifest := artifactManifest{
+		Name:       artifact.Name,
+		Namespace:  artifact.Namespace,
+		Generation: artifact.Generation,
+		Files:      []manifestFile{},
+		Source:     artifact.Status.Source,
+	}
+	for _, file := range artifact.Status.Artifacts {
+		file := manifestFile{ArtifactFile: *file.DeepCopy(), Path: path.Join("/artifacts", file.Name)}
+		file.URLs = nil
+		manifest.Files = append(manifest.Files, file)
+	}
+
+	return manifest
+}
+
+// ensureExportManifest writes the export manifest of the current build to the
+// ConfigMap mounted by the exporters.
+func (r *OSArtifactReconciler) ensureExportManifest(ctx context.Context, artifact *osbuilder.OSArtifact) error {
+	data, err := json.MarshalIndent(newArtifactManifest(artifact), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      exportManifestName(artifact),
+			Namespace: artifact.Namespace,
+			Labels: map[string]string{
+				artifactLabel: artifact.Name,
+			},
+		},
+		Data: map[string]string{
+			exportManifestKey: string(data),
+		},
+	}
+	if err := controllerutil.SetOwnerReference(artifact, cm, r.Scheme()); err != nil {
+		return err
+	}
+
+	err = r.Create(ctx, cm)
+	if apierrors.IsAlreadyExists(err) {
+		// Left by a previous build
+		return r.Update(ctx, cm)
+	}
+	return err
+}
+
+// artifactEnv describes the artifact to the exporter containers.
+func artifactEnv(artifact *osbuilder.OSArtifact) []corev1.EnvVar {
+	var files []string
+	for _, file := range artifact.Status.Artifacts {
+		files = append(files, path.Join("/artifacts", file.Name))
+	}
+	source := artifact.Status.Source
+	if source == nil {
+		source = &osbuilder.SourceStatus{}
+	}
+
+	return []corev1.EnvVar{
+		{Name: "OSBUILDER_ARTIFACT_NAME", Value: artifact.Name},
+		{Name: "OSBUILDER_ARTIFACT_NAMESPACE", Value: artifact.Namespace},
+		{Name: "OSBUILDER_ARTIFACT_GENERATION", Value: fmt.Sprintf("%d", artifact.Generation)},
+		{Name: "OSBUILDER_ARTIFACTS_DIR", Value: "/artifacts"},
+		{Name: "OSBUILDER_FILES", Value: strings.Join(files, " ")},
+		{Name: "OSBUILDER_MANIFEST", Value: path.Join(exportManifestDir, exportManifestKey)},
+		{Name: "OSBUILDER_SOURCE_IMAGE", Value: source.Image},
+		{Name: "OSBUILDER_SOURCE_DIGEST", Value: source.Digest},
+		{Name: "OSBUILDER_KAIROS_VERSION", Value: source.KairosVersion},
+		{Name: "OSBUILDER_KAIROS_FLAVOR", Value: source.KairosFlavor},
+	}
+}
+
+// injectArtifactMetadata adds the artifact environment variables and the
+// export manifest to every container of an exporter pod. Variables set by the
+// exporter are kept.
+func injectArtifactMetadata(podSpec *corev1.PodSpec, artifact *osbuilder.OSArtifact) {
+	env := artifactEnv(artifact)
+	inject := func(container *corev1.Container) {
+		outputs := container.TerminationMessagePath
+		if outputs == "" {
+			outputs = corev1.TerminationMessagePathDefault
+		}
+		for _, envVar := range append(env, corev1.EnvVar{Name: "OSBUILDER_OUTPUTS", Value: outputs}) {
+			if !hasEnv(container.Env, envVar.Name) {
+				container.Env = append(container.Env, envVar)
+			}
+		}
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      "osbuilder-manifest",
+			MountPath: exportManifestDir,
+			ReadOnly:  true,
+		})
+	}
+	for i := range podSpec.InitContainers {
+		inject(&podSpec.InitContainers[i])
+	}
+	for i := range podSpec.Containers {
+		inject(&podSpec.Containers[i])
+	}
+
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: "osbuilder-manifest",
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: exportManifestName(artifact)},
+			},
+		},
+	})
+}
+
+func hasEnv(env []corev1.EnvVar, name string) bool {
+	for _, envVar := range env {
+		if envVar.Name == name {
+			return true
+		}
+	}
+	return false
+}
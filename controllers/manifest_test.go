@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("Export manifest", func() {
+	var artifact *osbuilder.OSArtifact
+	var r *OSArtifactReconciler
+
+	BeforeEach(func() {
+		exporter := osbuilder.Exporter{Template: &corev1.PodTemplateSpec{}}
+		exporter.Template.Spec.InitContainers = []corev1.Container{{Name: "prepare", Image: "busybox"}}
+		exporter.Template.Spec.Containers = []corev1.Container{{
+			Name:  "upload",
+			Image: "busybox",
+			Env:   []corev1.EnvVar{{Name: "OSBUILDER_FILES", Value: "/artifacts/custom.iso"}},
+		}}
+
+		artifact = &osbuilder.OSArtifact{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default", UID: "uid", Generation: 3},
+			Spec:       osbuilder.OSArtifactSpec{Exporters: []osbuilder.Exporter{exporter}},
+			Status: osbuilder.OSArtifactStatus{
+				Phase: osbuilder.Exporting,
+				Artifacts: []osbuilder.ArtifactFile{
+					{Name: "test.iso", Type: osbuilder.ArtifactISO, Size: 42, SHA256: "abc"},
+					{Name: "test.tar", Type: osbuilder.ArtifactContainerImage, Size: 7, SHA256: "def"},
+				},
+				Source: &osbuilder.SourceStatus{
+					Image:         "quay.io/kairos/core-opensuse:latest",
+					Digest:        "sha256:123",
+					KairosVersion: "v2.4.0",
+					KairosFlavor:  "opensuse",
+				},
+			},
+		}
+		pvc := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-artifacts",
+				Namespace: "default",
+				Labels:    map[string]string{artifactLabel: "test"},
+			},
+		}
+
+		r = &OSArtifactReconciler{Client: newFakeClient(artifact, pvc)}
+	})
+
+	It("describes the artifact to every exporter container", func() {
+		_, err := r.checkExport(context.TODO(), artifact)
+		Expect(err).ToNot(HaveOccurred())
+
+		var job batchv1.Job
+		Expect(r.Get(context.TODO(), client.ObjectKey{Namespace: "default", Name: "test-export-0"}, &job)).To(Succeed())
+		podSpec := job.Spec.Template.Spec
+
+		for _, container := range append(podSpec.InitContainers, podSpec.Containers...) {
+			Expect(container.Env).To(ContainElements(
+				corev1.EnvVar{Name: "OSBUILDER_ARTIFACT_NAME", Value: "test"},
+				corev1.EnvVar{Name: "OSBUILDER_SOURCE_DIGEST", Value: "sha256:123"},
+				corev1.EnvVar{Name: "OSBUILDER_KAIROS_VERSION", Value: "v2.4.0"},
+				corev1.EnvVar{Name: "OSBUILDER_MANIFEST", Value: "/osbuilder/manifest.json"},
+			))
+			Expect(container.VolumeMounts).To(ContainElement(HaveField("MountPath", "/osbuilder")))
+		}
+		Expect(podSpec.InitContainers[0].Env).To(ContainElement(
+			corev1.EnvVar{Name: "OSBUILDER_FILES", Value: "/artifacts/test.iso /artifacts/test.tar"}))
+		Expect(podSpec.Containers[0].Env).To(ContainElement(
+			corev1.EnvVar{Name: "OSBUILDER_FILES", Value: "/artifacts/custom.iso"}))
+		Expect(podSpec.Containers[0].Env).ToNot(ContainElement(
+			corev1.EnvVar{Name: "OSBUILDER_FILES", Value: "/artifacts/test.iso /artifacts/test.tar"}))
+	})
+
+	It("writes the manifest the exporters mount", func() {
+		Expect(r.ensureExportManifest(context.TODO(), artifact)).To(Succeed())
+		artifact.Status.Source.KairosVersion = "v2.4.1"
+		Expect(r.ensureExportManifest(context.TODO(), artifact)).To(Succeed())
+
+		var cm corev1.ConfigMap
+		Expect(r.Get(context.TODO(), client.ObjectKey{Namespace: "default", Name: "test-export-manifest"}, &cm)).To(Succeed())
+
+		var manifest map[string]interface{}
+		Expect(json.Unmarshal([]byte(cm.Data[exportManifestKey]), &manifest)).To(Succeed())
+		Expect(manifest).To(HaveKeyWithValue("generation", BeEquivalentTo(3)))
+		Expect(manifest["source"]).To(HaveKeyWithValue("kairosVersion", "v2.4.1"))
+		Expect(manifest["files"]).To(ContainElement(And(
+			HaveKeyWithValue("name", "test.iso"),
+			HaveKeyWithValue("path", "/artifacts/test.iso"),
+			HaveKeyWithValue("type", "ISO"),
+			HaveKeyWithValue("sha256", "abc"),
+		)))
+	})
+
+	It("reads the source described by the builder pod", func() {
+		pod := &corev1.Pod{
+			Status: corev1.PodStatus{
+				InitContainerStatuses: []corev1.ContainerStatus{{
+					Name: describeSourceContainerName,
+					State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+						Message: `{"image":"quay.io/kairos/core-opensuse:latest","digest":"","kairosVersion":"v2.4.0","kairosFlavor":"opensuse"}`,
+					}},
+				}},
+			},
+		}
+
+		source, err := describedSource(pod)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(source).To(Equal(&osbuilder.SourceStatus{
+			Image:         "quay.io/kairos/core-opensuse:latest",
+			KairosVersion: "v2.4.0",
+			KairosFlavor:  "opensuse",
+		}))
+	})
+})
@@ -0,0 +1,218 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	ociArtifactContainerName = "push-oci-artifact"
+
+	// DefaultOrasImage provides oras, which pushes the OCI artifacts.
+	DefaultOrasImage = "ghcr.io/oras-project/oras:v1.2.0"
+
+	// ociArtifactType is the artifact type of the pushed manifests.
+	ociArtifactType = "application/vnd.kairos.os-artifact.v1"
+)
+
+// ociMediaTypes are the media types of the layers holding each type of file.
+var ociMediaTypes = map[osbuilder.ArtifactType]string{
+	osbuilder.ArtifactISO:            "application/vnd.kairos.iso.v1",
+	osbuilder.ArtifactRawImage:       "application/vnd.kairos.disk.raw.v1",
+	osbuilder.ArtifactAzureImage:     "application/vnd.kairos.disk.vhd.v1",
+	osbuilder.ArtifactGCEImage:       "application/vnd.kairos.disk.gce.v1",
+	osbuilder.ArtifactNetbootKernel:  "application/vnd.kairos.netboot.kernel.v1",
+	osbuilder.ArtifactNetbootInitrd:  "application/vnd.kairos.netboot.initrd.v1",
+	osbuilder.ArtifactNetbootRootfs:  "application/vnd.kairos.netboot.squashfs.v1",
+	osbuilder.ArtifactNetbootScript:  "application/vnd.kairos.netboot.ipxe.v1",
+	osbuilder.ArtifactContainerImage: "application/vnd.oci.image.layer.v1.tar",
+	osbuilder.ArtifactChecksum:       "text/plain",
+	osbuilder.ArtifactManifest:       "application/json",
+	osbuilder.ArtifactSignature:      "text/plain",
+	osbuilder.ArtifactOther:          "application/octet-stream",
+}
+
+// defaultOCIArtifactTypes are the files published when spec.ociArtifact.types
+// is not set.
+var defaultOCIArtifactTypes = []osbuilder.ArtifactType{
+	osbuilder.ArtifactISO,
+	osbuilder.ArtifactRawImage,
+	osbuilder.ArtifactAzureImage,
+	osbuilder.ArtifactGCEImage,
+	osbuilder.ArtifactNetbootKernel,
+	osbuilder.ArtifactNetbootInitrd,
+	osbuilder.ArtifactNetbootRootfs,
+	osbuilder.ArtifactNetbootScript,
+}
+
+// readKairosReleaseScript sets KAIROS_VERSION and KAIROS_FLAVOR from the
+// release file of the rootfs. The file comes from the built image, so it is
+// parsed rather than sourced.
+const readKairosReleaseScript = `kairos_release() {
+  if [ -f /rootfs/etc/kairos-release ]; then
+    sed -n "s/^$1=//p" /rootfs/etc/kairos-release | head -n 1 | tr -d "\"'"
+  fi
+}
+KAIROS_VERSION=$(kairos_release KAIROS_VERSION)
+KAIROS_FLAVOR=$(kairos_release KAIROS_FLAVOR)
+`
+
+// ociArtifactScript pushes the selected files of the artifacts volume as one
+// OCI artifact, annotated with the Kairos release of the rootfs, then tags it
+// and writes its digest reference to the termination log, where checkBuild
+// collects it. The digest is the one of the exported manifest, which is
+// pushed as is.
+func ociArtifactScript(spec *osbuilder.OCIArtifactSpec) string {
+	types := spec.Types
+	if len(types) == 0 {
+		types = defaultOCIArtifactTypes
+	}
+	selected := map[osbuilder.ArtifactType]bool{}
+	for _, t := range types {
+		selected[t] = true
+	}
+
+	var script strings.Builder
+	script.WriteString(readKairosReleaseScript)
+	script.WriteString(`cd /artifacts
+set --
+for f in $(find . -type f | sed 's|^\./||' | sort); do
+  case "$f" in
+`)
+	for _, s := range artifactSuffixes {
+		if selected[s.fileType] {
+			fmt.Fprintf(&script, "  *%s) set -- \"$@\" \"$f:%s\" ;;\n", s.suffix, ociMediaTypes[s.fileType])
+		} else {
+			fmt.Fprintf(&script, "  *%s) ;;\n", s.suffix)
+		}
+	}
+	if selected[osbuilder.ArtifactOther] {
+		fmt.Fprintf(&script, "  *) set -- \"$@\" \"$f:%s\" ;;\n", ociMediaTypes[osbuilder.ArtifactOther])
+	}
+	script.WriteString(`  esac
+done
+if [ "$#" -eq 0 ]; then
+  echo "no file to publish" >&2
+  exit 1
+fi
+if [ -n "${KAIROS_VERSION:-}" ]; then
+  set -- --annotation "io.kairos.version=$KAIROS_VERSION" --annotation "org.opencontainers.image.version=$KAIROS_VERSION" "$@"
+fi
+if [ -n "${KAIROS_FLAVOR:-}" ]; then
+  set -- --annotation "io.kairos.flavor=$KAIROS_FLAVOR" "$@"
+fi
+`)
+
+	keys := make([]string, 0, len(spec.Annotations))
+	for key := range spec.Annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&script, "set -- --annotation %s \"$@\"\n", shellQuote(key+"="+spec.Annotations[key]))
+	}
+
+	script.WriteString(`oras push $REGISTRY_FLAGS --artifact-type "$ARTIFACT_TYPE" \
+  --annotation "io.kairos.artifact=$ARTIFACT" --export-manifest /tmp/manifest.json "$DESTINATION" "$@"
+ref="$REPOSITORY@sha256:$(sha256sum /tmp/manifest.json | cut -d' ' -f1)"
+for tag in $TAGS; do
+  oras tag $REGISTRY_FLAGS "$ref" "$tag"
+done
+printf '%s' "$ref" > /dev/termination-log
+if [ -d /pushed ]; then printf '%s' "$ref" > /pushed/ref; fi
+`)
+
+	return script.String()
+}
+
+// imageRepository strips the tag and digest from an image reference.
+func imageRepository(ref string) string {
+	ref, _, _ = strings.Cut(ref, "@")
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		ref = ref[:i]
+	}
+	return ref
+}
+
+func ociArtifactContainer(containerImage string, artifact *osbuilder.OSArtifact) corev1.Container {
+	spec := artifact.Spec.OCIArtifact
+
+	registryFlags := []string{}
+	volumeMounts := []corev1.VolumeMount{
+		{
+			Name:      "artifacts",
+			MountPath: "/artifacts",
+			ReadOnly:  true,
+		},
+		{
+			Name:      "rootfs",
+			MountPath: "/rootfs",
+			ReadOnly:  true,
+		},
+	}
+	if spec.Insecure {
+		registryFlags = append(registryFlags, "--plain-http")
+	}
+	if spec.CredentialsSecretRef != nil {
+		registryFlags = append(registryFlags, "--registry-config", "/oci/docker/config.json")
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      "oci-credentials",
+			MountPath: "/oci/docker",
+			ReadOnly:  true,
+		})
+	}
+	if spec.CARef != nil {
+		registryFlags = append(registryFlags, "--ca-file", "/oci/ca/ca.crt")
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      "oci-ca",
+			MountPath: "/oci/ca",
+			ReadOnly:  true,
+		})
+	}
+
+	return corev1.Container{
+		ImagePullPolicy: corev1.PullAlways,
+		Name:            ociArtifactContainerName,
+		Image:           containerImage,
+		Command:         []string{"/bin/sh", "-cxe"},
+		Args:            []string{ociArtifactScript(spec)},
+		Env: []corev1.EnvVar{
+			{Name: "ARTIFACT", Value: artifact.Name},
+			{Name: "ARTIFACT_TYPE", Value: ociArtifactType},
+			{Name: "DESTINATION", Value: spec.Destination},
+			{Name: "REPOSITORY", Value: imageRepository(spec.Destination)},
+			{Name: "TAGS", Value: strings.Join(spec.Tags, " ")},
+			{Name: "REGISTRY_FLAGS", Value: strings.Join(registryFlags, " ")},
+		},
+		TerminationMessagePolicy: corev1.TerminationMessageReadFile,
+		VolumeMounts:             volumeMounts,
+	}
+}
+
+// orasImage returns the image the push-oci-artifact container runs.
+func (r *OSArtifactReconciler) orasImage() string {
+	if r.OrasImage != "" {
+		return r.OrasImage
+	}
+	return DefaultOrasImage
+}
@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("OCI artifact", func() {
+	var artifact *osbuilder.OSArtifact
+
+	BeforeEach(func() {
+		artifact = &osbuilder.OSArtifact{
+			ObjectMeta: metav1.ObjectMeta{Name: "test"},
+			Spec: osbuilder.OSArtifactSpec{
+				ImageName: "quay.io/kairos/core-opensuse:latest",
+				ISO:       true,
+				Push:      &osbuilder.PushSpec{Destination: "localhost:5000/kairos/custom:v1"},
+				OCIArtifact: &osbuilder.OCIArtifactSpec{
+					PushSpec: osbuilder.PushSpec{
+						Destination:          "localhost:5000/kairos/iso:v1",
+						Tags:                 []string{"latest"},
+						CredentialsSecretRef: &corev1.LocalObjectReference{Name: "registry"},
+						Insecure:             true,
+					},
+					Annotations: map[string]string{"org.opencontainers.image.source": "https://example.com/it's"},
+				},
+			},
+		}
+	})
+
+	It("pushes after the image and before reporting the artifacts", func() {
+		r := &OSArtifactReconciler{ToolImage: "quay.io/kairos/auroraboot:latest"}
+		pod := r.newBuilderPod("test-artifacts", artifact)
+
+		var names []string
+		for _, container := range pod.Spec.InitContainers {
+			names = append(names, container.Name)
+		}
+		Expect(names[len(names)-2:]).To(Equal([]string{pushImageContainerName, ociArtifactContainerName}))
+
+		oci := pod.Spec.InitContainers[len(names)-1]
+		Expect(oci.Image).To(Equal(DefaultOrasImage))
+		Expect(oci.Env).To(ContainElements(
+			corev1.EnvVar{Name: "REPOSITORY", Value: "localhost:5000/kairos/iso"},
+			corev1.EnvVar{Name: "REGISTRY_FLAGS", Value: "--plain-http --registry-config /oci/docker/config.json"},
+		))
+
+		var volumes []string
+		for _, volume := range pod.Spec.Volumes {
+			volumes = append(volumes, volume.Name)
+		}
+		Expect(volumes).To(ContainElement("oci-credentials"))
+		Expect(volumes).ToNot(ContainElement("push-credentials"))
+	})
+
+	It("publishes the selected files with their media types", func() {
+		script := ociArtifactScript(artifact.Spec.OCIArtifact)
+		Expect(script).To(ContainSubstring(`*.iso) set -- "$@" "$f:application/vnd.kairos.iso.v1" ;;`))
+		Expect(script).To(ContainSubstring("*.sha256) ;;\n"))
+		Expect(script).To(ContainSubstring(`set -- --annotation 'org.opencontainers.image.source=https://example.com/it'\''s' "$@"`))
+
+		artifact.Spec.OCIArtifact.Types = []osbuilder.ArtifactType{osbuilder.ArtifactChecksum}
+		script = ociArtifactScript(artifact.Spec.OCIArtifact)
+		Expect(script).To(ContainSubstring(`*.sha256) set -- "$@" "$f:text/plain" ;;`))
+		Expect(script).To(ContainSubstring("*.iso) ;;\n"))
+	})
+
+	It("strips tags and digests from references", func() {
+		Expect(imageRepository("localhost:5000/kairos/iso:v1")).To(Equal("localhost:5000/kairos/iso"))
+		Expect(imageRepository("localhost:5000/kairos/iso")).To(Equal("localhost:5000/kairos/iso"))
+		Expect(imageRepository("quay.io/kairos/iso@sha256:abc")).To(Equal("quay.io/kairos/iso"))
+	})
+
+	It("reports a failed push", func() {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-abc"},
+			Status: corev1.PodStatus{
+				Phase: corev1.PodFailed,
+				InitContainerStatuses: []corev1.ContainerStatus{{
+					Name:  ociArtifactContainerName,
+					State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1}},
+				}},
+			},
+		}
+		_, reason, _ := podFailure(pod)
+		Expect(reason).To(Equal(osbuilder.ReasonPushFailed))
+	})
+})
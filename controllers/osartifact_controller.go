@@ -19,11 +19,16 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
@@ -42,12 +47,41 @@ const (
 	FinalizerName                   = "build.kairos.io/osbuilder-finalizer"
 	artifactLabel                   = "build.kairos.io/artifact"
 	artifactExporterIndexAnnotation = "build.kairos.io/export-index"
+	// artifactGenerationAnnotation holds the status.observedGeneration an
+	// exporter job was created for.
+	artifactGenerationAnnotation = "build.kairos.io/generation"
 )
 
 // OSArtifactReconciler reconciles a OSArtifact object
 type OSArtifactReconciler struct {
 	client.Client
 	ServingImage, ToolImage, CopierImage string
+	// PushImage runs crane to push images, see spec.push.
+	PushImage string
+	// OrasImage runs oras to push OCI artifacts, see spec.ociArtifact.
+	OrasImage string
+	// CosignImage and GPGImage run cosign and gpg to sign the artifacts,
+	// see spec.signing.
+	CosignImage string
+	GPGImage    string
+	// S3Image runs the AWS CLI to upload artifacts, see spec.exporters[].s3.
+	S3Image string
+	// ServeNamespace runs the HTTP server the artifacts with spec.serve are
+	// copied to. Serving is disabled when empty.
+	ServeNamespace string
+	// ServeVolume is the PVC the server serves files from, ServeRole the Role
+	// letting the copier jobs exec into the server pods and ServeURL the base
+	// URL of the download links.
+	ServeVolume, ServeRole, ServeURL string
+	// BuildResources are the default resources of the builder containers.
+	BuildResources *osbuilder.BuildResources
+	// MaxConcurrentBuilds limits the builds running at once, in the whole
+	// cluster and in each namespace. 0 means no limit.
+	MaxConcurrentBuilds, MaxConcurrentBuildsPerNamespace int
+	// APIReader lists the builder pods holding a build slot straight from the
+	// API server, the cache may miss a pod started by the previous reconcile.
+	// Defaults to the client.
+	APIReader client.Reader
 }
 
 func (r *OSArtifactReconciler) InjectClient(c client.Client) error {
@@ -60,10 +94,13 @@ func (r *OSArtifactReconciler) InjectClient(c client.Client) error {
 //+kubebuilder:rbac:groups=build.kairos.io,resources=osartifacts/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=build.kairos.io,resources=osartifacts/finalizers,verbs=update
 //+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;create;delete
-//+kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;create;delete;watch
+//+kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;create;update;delete;watch
 //+kubebuilder:rbac:groups="",resources=secrets,verbs=get;
-//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;create;
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;create;update;delete
 //+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;delete
+//+kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update
+//+kubebuilder:rbac:groups="",resources=services,verbs=create
+//+kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=create;delete
 
 func (r *OSArtifactReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := log.FromContext(ctx)
@@ -77,6 +114,23 @@ func (r *OSArtifactReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	}
 
 	if artifact.DeletionTimestamp != nil {
+		if !controllerutil.ContainsFinalizer(&artifact, FinalizerName) {
+			return ctrl.Result{}, nil
+		}
+		cleaned, err := r.runCleanup(ctx, &artifact)
+		if err != nil {
+			return ctrl.Result{Requeue: true}, err
+		}
+		if !cleaned {
+			// Cleanup jobs are watched, their progress triggers a reconcile
+			return ctrl.Result{}, r.Status().Update(ctx, &artifact)
+		}
+		if err := r.releaseVolume(ctx, &artifact); err != nil {
+			return ctrl.Result{Requeue: true}, err
+		}
+		if err := r.releaseServing(ctx, &artifact); err != nil {
+			return ctrl.Result{Requeue: true}, err
+		}
 		controllerutil.RemoveFinalizer(&artifact, FinalizerName)
 		return ctrl.Result{}, r.Update(ctx, &artifact)
 	}
@@ -90,11 +144,44 @@ func (r *OSArtifactReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 	logger.Info(fmt.Sprintf("Reconciling %s/%s", artifact.Namespace, artifact.Name))
 
+	if artifact.Status.ObservedGeneration != artifact.Generation {
+		switch {
+		case waitsForBuild(&artifact):
+			// Nothing was built yet, the next build picks up the new spec.
+		case artifact.Status.ObservedGeneration == 0:
+			// Built before generations were tracked, adopt it as is.
+			artifact.Status.ObservedGeneration = artifact.Generation
+			artifact.Status.BuildHash = artifact.Spec.BuildHash()
+			artifact.Status.ExportHash = artifact.Spec.ExportHash()
+			return ctrl.Result{}, r.Status().Update(ctx, &artifact)
+		case artifact.Status.BuildHash == artifact.Spec.BuildHash():
+			// Only fields that do not change the build were updated.
+			if exportsChanged(&artifact) {
+				return r.reexport(ctx, &artifact)
+			}
+			artifact.Status.ObservedGeneration = artifact.Generation
+			return ctrl.Result{}, r.Status().Update(ctx, &artifact)
+		case artifact.Spec.RebuildPolicy != osbuilder.RebuildNever:
+			return r.rebuild(ctx, &artifact)
+		}
+	}
+
+	switch artifact.Status.Phase {
+	case osbuilder.Ready, osbuilder.Error:
+		// Suspending finished artifacts has no effect, they still expire
+		return r.checkFinished(ctx, &artifact)
+	}
+
+	if artifact.Spec.Suspend {
+		return r.suspend(ctx, &artifact)
+	}
+	if artifact.Status.Phase == osbuilder.Suspended {
+		return r.resume(ctx, &artifact)
+	}
+
 	switch artifact.Status.Phase {
 	case osbuilder.Exporting:
 		return r.checkExport(ctx, &artifact)
-	case osbuilder.Ready, osbuilder.Error:
-		return ctrl.Result{}, nil
 	default:
 		return r.checkBuild(ctx, &artifact)
 	}
@@ -127,30 +214,75 @@ func (r *OSArtifactReconciler) createPVC(ctx context.Context, artifact *osbuilde
 		return pvc, err
 	}
 	if err := r.Create(ctx, pvc); err != nil {
-		return pvc, err
+		if !apierrors.IsAlreadyExists(err) {
+			return pvc, err
+		}
+		// Left over from a previous build of this artifact, or retained
+		// from a deleted artifact of the same name
+		if err := r.Get(ctx, client.ObjectKeyFromObject(pvc), pvc); err != nil {
+			return pvc, err
+		}
+		adopted, err := r.adoptVolume(artifact, pvc)
+		if err != nil {
+			return pvc, err
+		}
+		if adopted {
+			if err := r.Update(ctx, pvc); err != nil {
+				return pvc, err
+			}
+		}
 	}
 
 	return pvc, nil
 }
 
 func (r *OSArtifactReconciler) createBuilderPod(ctx context.Context, artifact *osbuilder.OSArtifact, pvc *corev1.PersistentVolumeClaim) (*corev1.Pod, error) {
+	attempt := nextAttempt(artifact)
 	pod := r.newBuilderPod(pvc.Name, artifact)
+	pod.GenerateName = ""
+	pod.Name = builderPodName(artifact, attempt)
 	if pod.Labels == nil {
 		pod.Labels = map[string]string{}
 	}
 	pod.Labels[artifactLabel] = artifact.Name
+	pod.Labels[attemptLabel] = strconv.Itoa(int(attempt))
 	if err := controllerutil.SetOwnerReference(artifact, pod, r.Scheme()); err != nil {
 		return pod, err
 	}
 
 	if err := r.Create(ctx, pod); err != nil {
-		return pod, err
+		if !apierrors.IsAlreadyExists(err) {
+			return pod, err
+		}
+		// Created by an earlier reconcile whose status update was lost or is
+		// not in the cache yet. Adopt it instead of starting a second build.
+		if err := r.Get(ctx, client.ObjectKeyFromObject(pod), pod); err != nil {
+			return pod, err
+		}
 	}
 
 	return pod, nil
 }
 
 func (r *OSArtifactReconciler) startBuild(ctx context.Context, artifact *osbuilder.OSArtifact) (ctrl.Result, error) {
+	attempt := nextAttempt(artifact)
+	if attempt == 1 {
+		// Retries keep the build slot of the first attempt
+		position, err := r.buildQueuePosition(ctx, artifact)
+		if err != nil {
+			return ctrl.Result{Requeue: true}, err
+		}
+		if position > 0 {
+			if artifact.Status.Phase != osbuilder.Queued || artifact.Status.QueuePosition != position {
+				markQueued(artifact, position)
+				if err := r.Status().Update(ctx, artifact); err != nil {
+					return ctrl.Result{Requeue: true}, err
+				}
+			}
+			return ctrl.Result{RequeueAfter: queueRecheckInterval}, nil
+		}
+	}
+
 	err := r.CreateConfigMap(ctx, artifact)
 	if err != nil {
 		return ctrl.Result{Requeue: true}, err
@@ -160,13 +292,37 @@ func (r *OSArtifactReconciler) startBuild(ctx context.Context, artifact *osbuild
 	if err != nil {
 		return ctrl.Result{Requeue: true}, err
 	}
+	if pvc.Labels[artifactLabel] != artifact.Name {
+		// Orphaned by a deleted artifact of the same name, or not created by
+		// the operator at all. Building into it would mix in its content.
+		markFailed(artifact, osbuilder.ConditionBuilt, osbuilder.ReasonVolumeConflict,
+			fmt.Sprintf("PVC %s already exists and is not the artifacts volume of this artifact", pvc.Name))
+		if err := r.Status().Update(ctx, artifact); err != nil {
+			return ctrl.Result{Requeue: true}, err
+		}
+		return ctrl.Result{}, nil
+	}
+	if pvc.DeletionTimestamp != nil {
+		// The volume of a previous build is still being deleted
+		return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+	}
 
-	_, err = r.createBuilderPod(ctx, artifact, pvc)
+	pod, err := r.createBuilderPod(ctx, artifact, pvc)
 	if err != nil {
 		return ctrl.Result{Requeue: true}, err
 	}
+	if pod.DeletionTimestamp != nil {
+		// The builder pod of a suspended build is still being deleted
+		return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+	}
 
-	artifact.Status.Phase = osbuilder.Building
+	if attempt == 1 {
+		markBuilding(artifact)
+		startAttempt(artifact, attempt, pod)
+	} else {
+		startAttempt(artifact, attempt, pod)
+		markAttemptStarted(artifact)
+	}
 	if err := r.Status().Update(ctx, artifact); err != nil {
 		return ctrl.Result{Requeue: true}, err
 	}
@@ -175,8 +331,20 @@ func (r *OSArtifactReconciler) startBuild(ctx context.Context, artifact *osbuild
 }
 
 func (r *OSArtifactReconciler) checkBuild(ctx context.Context, artifact *osbuilder.OSArtifact) (ctrl.Result, error) {
+	var attempt int32
+	if current := currentAttempt(artifact); current != nil && artifact.Status.Phase == osbuilder.Building {
+		if current.Outcome == osbuilder.AttemptFailed {
+			if delay := retryDelay(artifact); delay > 0 {
+				return ctrl.Result{RequeueAfter: delay}, nil
+			}
+			return r.startBuild(ctx, artifact)
+		}
+		attempt = current.Attempt
+	}
+
 	var pods corev1.PodList
 	if err := r.List(ctx, &pods, &client.ListOptions{
+		Namespace: artifact.Namespace,
 		LabelSelector: labels.SelectorFromSet(labels.Set{
 			artifactLabel: artifact.Name,
 		}),
@@ -185,24 +353,92 @@ func (r *OSArtifactReconciler) checkBuild(ctx context.Context, artifact *osbuild
 	}
 
 	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp != nil {
+			// Left over from a build that was torn down
+			continue
+		}
+		if podAttempt(&pod) != attempt {
+			// Kept around from a failed attempt
+			continue
+		}
+
 		switch pod.Status.Phase {
 		case corev1.PodSucceeded:
-			artifact.Status.Phase = osbuilder.Exporting
+			files, err := builtArtifacts(&pod)
+			if err != nil {
+				return r.failAttempt(ctx, artifact, attempt, osbuilder.ConditionBuilt, osbuilder.ReasonBuildFailed, err.Error())
+			}
+			artifact.Status.Artifacts = files
+			source, err := describedSource(&pod)
+			if err != nil {
+				log.FromContext(ctx).Error(err, "failed to collect the source description")
+			}
+			artifact.Status.Source = source
+			push, err := pushedImage(&pod, pushImageContainerName, artifact.Spec.Push)
+			if err != nil {
+				log.FromContext(ctx).Error(err, "failed to collect the pushed image")
+			}
+			artifact.Status.Push = push
+			if artifact.Spec.OCIArtifact != nil {
+				ociArtifact, err := pushedImage(&pod, ociArtifactContainerName, &artifact.Spec.OCIArtifact.PushSpec)
+				if err != nil {
+					log.FromContext(ctx).Error(err, "failed to collect the pushed OCI artifact")
+				}
+				artifact.Status.OCIArtifact = ociArtifact
+			}
+			recordSignatures(artifact)
+			if current := currentAttempt(artifact); current != nil {
+				current.Node = pod.Spec.NodeName
+			}
+			finishAttempt(artifact, osbuilder.AttemptSucceeded, "", "")
+			markExporting(artifact)
 			return ctrl.Result{Requeue: true}, r.Status().Update(ctx, artifact)
 		case corev1.PodFailed:
-			artifact.Status.Phase = osbuilder.Error
-			return ctrl.Result{Requeue: true}, r.Status().Update(ctx, artifact)
+			condType, reason, message := podFailure(&pod)
+			return r.failAttempt(ctx, artifact, attempt, condType, reason, message)
 		case corev1.PodPending, corev1.PodRunning:
-			return ctrl.Result{}, nil
+			remaining, hasTimeout := buildTimeRemaining(artifact)
+			if hasTimeout && remaining <= 0 {
+				if err := r.Delete(ctx, &pod); client.IgnoreNotFound(err) != nil {
+					return ctrl.Result{Requeue: true}, err
+				}
+				return r.failAttempt(ctx, artifact, attempt, osbuilder.ConditionBuilt, osbuilder.ReasonTimedOut,
+					fmt.Sprintf("builder pod %s did not finish within %s", pod.Name, artifact.Spec.BuildTimeout.Duration))
+			}
+
+			result := ctrl.Result{}
+			if hasTimeout {
+				result.RequeueAfter = remaining
+			}
+			if updateSourceResolved(artifact, &pod) {
+				return result, r.Status().Update(ctx, artifact)
+			}
+			return result, nil
 		}
 	}
 
 	return r.startBuild(ctx, artifact)
 }
 
+// failAttempt records the failure of a build attempt, then either schedules
+// the next attempt or fails the artifact.
+func (r *OSArtifactReconciler) failAttempt(ctx context.Context, artifact *osbuilder.OSArtifact, attempt int32, condType, reason, message string) (ctrl.Result, error) {
+	finishAttempt(artifact, osbuilder.AttemptFailed, reason, message)
+	if shouldRetry(artifact, reason) {
+		delay := retryBackoff(artifact, attempt)
+		log.FromContext(ctx).Info("Build attempt failed, retrying", "attempt", attempt, "reason", reason, "backoff", delay)
+		markRetrying(artifact, reason, message, delay)
+		return ctrl.Result{RequeueAfter: delay}, r.Status().Update(ctx, artifact)
+	}
+
+	markFailed(artifact, condType, reason, message)
+	return ctrl.Result{Requeue: true}, r.Status().Update(ctx, artifact)
+}
+
 func (r *OSArtifactReconciler) checkExport(ctx context.Context, artifact *osbuilder.OSArtifact) (ctrl.Result, error) {
 	var jobs batchv1.JobList
 	if err := r.List(ctx, &jobs, &client.ListOptions{
+		Namespace: artifact.Namespace,
 		LabelSelector: labels.SelectorFromSet(labels.Set{
 			artifactLabel: artifact.Name,
 		}),
@@ -211,17 +447,19 @@ func (r *OSArtifactReconciler) checkExport(ctx context.Context, artifact *osbuil
 	}
 
 	indexedJobs := make(map[string]*batchv1.Job, len(artifact.Spec.Exporters))
-	for _, job := range jobs.Items {
-		if job.GetAnnotations() != nil {
-			if idx, ok := job.GetAnnotations()[artifactExporterIndexAnnotation]; ok {
-				indexedJobs[idx] = &job
-			}
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		if job.DeletionTimestamp != nil {
+			continue
+		}
+		if idx, ok := job.Annotations[artifactExporterIndexAnnotation]; ok {
+			indexedJobs[idx] = job
 		}
 	}
 
 	var pvcs corev1.PersistentVolumeClaimList
 	var pvc *corev1.PersistentVolumeClaim
-	if err := r.List(ctx, &pvcs, &client.ListOptions{LabelSelector: labels.SelectorFromSet(labels.Set{artifactLabel: artifact.Name})}); err != nil {
+	if err := r.List(ctx, &pvcs, &client.ListOptions{Namespace: artifact.Namespace, LabelSelector: labels.SelectorFromSet(labels.Set{artifactLabel: artifact.Name})}); err != nil {
 		return ctrl.Result{Requeue: true}, err
 	}
 
@@ -235,67 +473,362 @@ func (r *OSArtifactReconciler) checkExport(ctx context.Context, artifact *osbuil
 		return ctrl.Result{}, fmt.Errorf("failed to locate artifact pvc")
 	}
 
-	var succeeded int
-	for i := range artifact.Spec.Exporters {
-		idx := fmt.Sprintf("%d", i)
-
-		job := indexedJobs[idx]
-		if job == nil {
-			job = &batchv1.Job{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      fmt.Sprintf("%s-export-%s", artifact.Name, idx),
-					Namespace: artifact.Namespace,
-					Annotations: map[string]string{
-						artifactExporterIndexAnnotation: idx,
-					},
-					Labels: map[string]string{
-						artifactLabel: artifact.Name,
-					},
-				},
-				Spec: artifact.Spec.Exporters[i],
+	remaining, hasTimeout := exportTimeRemaining(artifact)
+	if hasTimeout && remaining <= 0 {
+		for _, job := range indexedJobs {
+			if err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+				return ctrl.Result{Requeue: true}, err
 			}
+		}
+		markFailed(artifact, osbuilder.ConditionExported, osbuilder.ReasonTimedOut,
+			fmt.Sprintf("exporters did not finish within %s", artifact.Spec.ExportTimeout.Duration))
+		return ctrl.Result{}, r.Status().Update(ctx, artifact)
+	}
 
-			job.Spec.Template.Spec.Volumes = append(job.Spec.Template.Spec.Volumes, corev1.Volume{
-				Name: "artifacts",
-				VolumeSource: corev1.VolumeSource{
-					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-						ClaimName: pvc.Name,
-						ReadOnly:  true,
-					},
-				},
-			})
+	if artifact.Spec.Serve && !r.serves() {
+		markFailed(artifact, osbuilder.ConditionExported, osbuilder.ReasonExportFailed,
+			"spec.serve is set, but the operator does not serve artifacts")
+		return ctrl.Result{}, r.Status().Update(ctx, artifact)
+	}
 
-			if err := controllerutil.SetOwnerReference(artifact, job, r.Scheme()); err != nil {
-				return ctrl.Result{Requeue: true}, err
-			}
+	exports := trackExports(artifact, indexedJobs)
+	if err := r.collectOutputs(ctx, artifact, exports, indexedJobs); err != nil {
+		return ctrl.Result{Requeue: true}, err
+	}
+	for i, export := range exports {
+		if export.Phase != osbuilder.ExportFailed || artifact.Spec.Exporters[i].AllowFailure {
+			continue
+		}
+		reason := osbuilder.ReasonExportFailed
+		if job := indexedJobs[fmt.Sprintf("%d", i)]; job != nil && jobTimedOut(job) {
+			reason = osbuilder.ReasonTimedOut
+		}
+		artifact.Status.Exports = exports
+		markFailed(artifact, osbuilder.ConditionExported, reason,
+			fmt.Sprintf("exporter %s failed: %s", export.Name, export.Message))
+		return ctrl.Result{}, r.Status().Update(ctx, artifact)
+	}
 
-			if err := r.Create(ctx, job); err != nil {
-				return ctrl.Result{Requeue: true}, err
+	served := !artifact.Spec.Serve
+	if job := indexedJobs[serveIndex]; job != nil {
+		phase, message := jobPhase(job)
+		if phase == osbuilder.ExportFailed {
+			markFailed(artifact, osbuilder.ConditionExported, osbuilder.ReasonExportFailed,
+				fmt.Sprintf("copying the artifacts to the HTTP server failed: %s", message))
+			return ctrl.Result{}, r.Status().Update(ctx, artifact)
+		}
+		served = phase == osbuilder.ExportSucceeded
+	} else if artifact.Spec.Serve {
+		if err := r.prepareServing(ctx, artifact); err != nil {
+			return ctrl.Result{Requeue: true}, err
+		}
+		if _, err := r.createExportJob(ctx, artifact, serveIndex, r.serveJobSpec(artifact), pvc); err != nil {
+			if apierrors.IsAlreadyExists(err) {
+				// The job of a previous build is still being deleted
+				return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
 			}
+			return ctrl.Result{Requeue: true}, err
+		}
+	}
 
-		} else if job.Spec.Completions == nil || *job.Spec.Completions == 1 {
-			if job.Status.Succeeded > 0 {
-				succeeded++
-			}
-		} else if *job.Spec.BackoffLimit <= job.Status.Failed {
-			artifact.Status.Phase = osbuilder.Error
-			if err := r.Status().Update(ctx, artifact); err != nil {
-				return ctrl.Result{Requeue: true}, err
+	// Start the exporters whose dependencies succeeded, the jobs they run
+	// trigger a reconcile when they finish.
+	running := len(exportNames(exports, osbuilder.ExportRunning))
+	for i := range exports {
+		if exports[i].Phase != osbuilder.ExportPending || !dependenciesSucceeded(artifact, i, exports) ||
+			!canStartExporter(artifact, running) {
+			continue
+		}
+
+		spec, err := r.exporterJobSpec(artifact, i)
+		if err != nil {
+			artifact.Status.Exports = exports
+			markFailed(artifact, osbuilder.ConditionExported, osbuilder.ReasonExportFailed,
+				fmt.Sprintf("exporter %s: %s", exports[i].Name, err))
+			return ctrl.Result{}, r.Status().Update(ctx, artifact)
+		}
+
+		job, err := r.createExportJob(ctx, artifact, fmt.Sprintf("%d", i), spec, pvc)
+		if err != nil {
+			if apierrors.IsAlreadyExists(err) {
+				// The job of a previous build is still being deleted
+				return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
 			}
-			break
+			return ctrl.Result{Requeue: true}, err
+		}
+		exports[i].Phase = osbuilder.ExportRunning
+		exports[i].Job = job.Name
+		running++
+	}
+
+	if served && exportsFinished(exports) {
+		artifact.Status.Exports = exports
+
+		cleaned, err := r.cleanupAfterExport(ctx, artifact)
+		if err != nil {
+			return ctrl.Result{Requeue: true}, err
+		}
+
+		if err := recordS3URLs(artifact, indexedJobs); err != nil {
+			return ctrl.Result{Requeue: true}, err
+		}
+		r.recordServedURLs(artifact)
+
+		markReady(artifact)
+		var messages []string
+		if failed := exportNames(exports, osbuilder.ExportFailed); len(failed) > 0 {
+			messages = append(messages, "Exporters allowed to fail failed: "+strings.Join(failed, ", "))
+		}
+		if skipped := exportNames(exports, osbuilder.ExportSkipped); len(skipped) > 0 {
+			messages = append(messages, "Skipped exporters: "+strings.Join(skipped, ", "))
 		}
+		if cleaned != "" {
+			messages = append(messages, cleaned)
+		}
+		artifact.Status.Message = strings.Join(messages, ". ")
+		if err := r.Status().Update(ctx, artifact); err != nil {
+			return ctrl.Result{Requeue: true}, err
+		}
+		return ctrl.Result{Requeue: true}, nil
 	}
 
-	if succeeded == len(artifact.Spec.Exporters) {
-		artifact.Status.Phase = osbuilder.Ready
+	if !equality.Semantic.DeepEqual(artifact.Status.Exports, exports) {
+		artifact.Status.Exports = exports
 		if err := r.Status().Update(ctx, artifact); err != nil {
 			return ctrl.Result{Requeue: true}, err
 		}
 	}
 
+	if hasTimeout {
+		return ctrl.Result{RequeueAfter: remaining}, nil
+	}
+	return ctrl.Result{}, nil
+}
+
+// createExportJob creates the job of an exporter, with the artifacts volume
+// mounted at /artifacts.
+func (r *OSArtifactReconciler) createExportJob(ctx context.Context, artifact *osbuilder.OSArtifact, idx string, spec batchv1.JobSpec, pvc *corev1.PersistentVolumeClaim) (*batchv1.Job, error) {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-export-%s", artifact.Name, idx),
+			Namespace: artifact.Namespace,
+			Annotations: map[string]string{
+				artifactExporterIndexAnnotation: idx,
+				artifactGenerationAnnotation:    fmt.Sprintf("%d", artifact.Status.ObservedGeneration),
+			},
+			Labels: map[string]string{
+				artifactLabel: artifact.Name,
+			},
+		},
+		Spec: spec,
+	}
+	applyExporterScheduling(&job.Spec.Template.Spec, artifact)
+	colocateWithVolume(&job.Spec.Template.Spec, artifact, pvc)
+	injectArtifactMetadata(&job.Spec.Template.Spec, artifact)
+	if job.Spec.ActiveDeadlineSeconds == nil {
+		job.Spec.ActiveDeadlineSeconds = activeDeadlineSeconds(artifact.Spec.ExportTimeout)
+	}
+
+	job.Spec.Template.Spec.Volumes = append(job.Spec.Template.Spec.Volumes, corev1.Volume{
+		Name: "artifacts",
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: pvc.Name,
+				ReadOnly:  true,
+			},
+		},
+	})
+
+	if err := controllerutil.SetOwnerReference(artifact, job, r.Scheme()); err != nil {
+		return nil, err
+	}
+	if err := r.ensureExportManifest(ctx, artifact); err != nil {
+		return nil, err
+	}
+
+	return job, r.Create(ctx, job)
+}
+
+// rebuild tears down the resources of the previous build, so that checkBuild
+// starts a new one for the current generation.
+func (r *OSArtifactReconciler) rebuild(ctx context.Context, artifact *osbuilder.OSArtifact) (ctrl.Result, error) {
+	log.FromContext(ctx).Info("Spec changed, rebuilding artifact",
+		"generation", artifact.Generation, "observedGeneration", artifact.Status.ObservedGeneration)
+
+	if err := r.deleteBuildResources(ctx, artifact); err != nil {
+		return ctrl.Result{Requeue: true}, err
+	}
+
+	markRebuilding(artifact)
+	if err := r.Status().Update(ctx, artifact); err != nil {
+		return ctrl.Result{Requeue: true}, err
+	}
+
+	return ctrl.Result{Requeue: true}, nil
+}
+
+// exportsChanged reports whether the exporters of a built artifact changed
+// since they last ran. Artifacts that are not built yet, or whose export stage
+// is suspended, run the current exporters once they get to it anyway.
+func exportsChanged(artifact *osbuilder.OSArtifact) bool {
+	if artifact.Status.Phase == osbuilder.Suspended ||
+		!meta.IsStatusConditionTrue(artifact.Status.Conditions, osbuilder.ConditionBuilt) {
+		return false
+	}
+
+	return artifact.Status.ExportHash != "" && artifact.Status.ExportHash != artifact.Spec.ExportHash()
+}
+
+// reexport deletes the exporter jobs of a built artifact and runs the export
+// stage again for the current generation, keeping the artifacts volume. An
+// artifact whose volume was already deleted is rebuilt instead.
+func (r *OSArtifactReconciler) reexport(ctx context.Context, artifact *osbuilder.OSArtifact) (ctrl.Result, error) {
+	var pvcs corev1.PersistentVolumeClaimList
+	if err := r.List(ctx, &pvcs, &client.ListOptions{
+		Namespace: artifact.Namespace,
+		LabelSelector: labels.SelectorFromSet(labels.Set{
+			artifactLabel: artifact.Name,
+		}),
+	}); err != nil {
+		return ctrl.Result{Requeue: true}, err
+	}
+	if len(pvcs.Items) == 0 {
+		if artifact.Spec.RebuildPolicy == osbuilder.RebuildNever {
+			markFailed(artifact, osbuilder.ConditionExported, osbuilder.ReasonExportFailed,
+				"exporters changed, but the artifacts volume was deleted and spec.rebuildPolicy is Never")
+			artifact.Status.ObservedGeneration = artifact.Generation
+			return ctrl.Result{}, r.Status().Update(ctx, artifact)
+		}
+		return r.rebuild(ctx, artifact)
+	}
+
+	log.FromContext(ctx).Info("Exporters changed, exporting artifact again",
+		"generation", artifact.Generation, "observedGeneration", artifact.Status.ObservedGeneration)
+
+	if err := r.deleteExporterJobs(ctx, artifact); err != nil {
+		return ctrl.Result{Requeue: true}, err
+	}
+
+	markReexporting(artifact)
+	if err := r.Status().Update(ctx, artifact); err != nil {
+		return ctrl.Result{Requeue: true}, err
+	}
+
+	return ctrl.Result{Requeue: true}, nil
+}
+
+// deleteBuildResources deletes the builder pods, exporter jobs, ConfigMap and
+// artifacts volume created for an artifact.
+func (r *OSArtifactReconciler) deleteBuildResources(ctx context.Context, artifact *osbuilder.OSArtifact) error {
+	listOpts := &client.ListOptions{
+		Namespace: artifact.Namespace,
+		LabelSelector: labels.SelectorFromSet(labels.Set{
+			artifactLabel: artifact.Name,
+		}),
+	}
+
+	if err := r.deleteBuilderPods(ctx, artifact); err != nil {
+		return err
+	}
+	if err := r.deleteExporterJobs(ctx, artifact); err != nil {
+		return err
+	}
+
+	var pvcs corev1.PersistentVolumeClaimList
+	if err := r.List(ctx, &pvcs, listOpts); err != nil {
+		return err
+	}
+	for i := range pvcs.Items {
+		if err := r.Delete(ctx, &pvcs.Items[i]); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      artifact.Name,
+			Namespace: artifact.Namespace,
+		},
+	}
+	return client.IgnoreNotFound(r.Delete(ctx, cm))
+}
+
+// deleteBuilderPods deletes the builder pods of every attempt.
+func (r *OSArtifactReconciler) deleteBuilderPods(ctx context.Context, artifact *osbuilder.OSArtifact) error {
+	var pods corev1.PodList
+	if err := r.List(ctx, &pods, &client.ListOptions{
+		Namespace: artifact.Namespace,
+		LabelSelector: labels.SelectorFromSet(labels.Set{
+			artifactLabel: artifact.Name,
+		}),
+	}); err != nil {
+		return err
+	}
+	for i := range pods.Items {
+		if err := r.Delete(ctx, &pods.Items[i]); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteExporterJobs deletes the exporter jobs along with their pods.
+func (r *OSArtifactReconciler) deleteExporterJobs(ctx context.Context, artifact *osbuilder.OSArtifact) error {
+	var jobs batchv1.JobList
+	if err := r.List(ctx, &jobs, &client.ListOptions{
+		Namespace: artifact.Namespace,
+		LabelSelector: labels.SelectorFromSet(labels.Set{
+			artifactLabel: artifact.Name,
+		}),
+	}); err != nil {
+		return err
+	}
+	for i := range jobs.Items {
+		if err := r.Delete(ctx, &jobs.Items[i], client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// suspend stops the build or the exporters of an artifact in progress. The
+// artifacts volume is kept, so that the exporters can run again on resume.
+func (r *OSArtifactReconciler) suspend(ctx context.Context, artifact *osbuilder.OSArtifact) (ctrl.Result, error) {
+	switch artifact.Status.Phase {
+	case osbuilder.Suspended:
+		return ctrl.Result{}, nil
+	case osbuilder.Exporting:
+		if err := r.deleteExporterJobs(ctx, artifact); err != nil {
+			return ctrl.Result{Requeue: true}, err
+		}
+	default:
+		if err := r.deleteBuilderPods(ctx, artifact); err != nil {
+			return ctrl.Result{Requeue: true}, err
+		}
+	}
+
+	log.FromContext(ctx).Info("Suspending artifact", "phase", artifact.Status.Phase)
+	markSuspended(artifact)
+	if err := r.Status().Update(ctx, artifact); err != nil {
+		return ctrl.Result{Requeue: true}, err
+	}
+
 	return ctrl.Result{}, nil
 }
 
+// resume restarts the stage a suspended artifact was stopped in.
+func (r *OSArtifactReconciler) resume(ctx context.Context, artifact *osbuilder.OSArtifact) (ctrl.Result, error) {
+	log.FromContext(ctx).Info("Resuming artifact")
+	markResumed(artifact)
+	if err := r.Status().Update(ctx, artifact); err != nil {
+		return ctrl.Result{Requeue: true}, err
+	}
+
+	return ctrl.Result{Requeue: true}, nil
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *OSArtifactReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
@@ -9,7 +9,9 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/phayes/freeport"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -20,6 +22,7 @@ import (
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 var _ = Describe("OSArtifactReconciler", func() {
@@ -171,3 +174,111 @@ var _ = Describe("OSArtifactReconciler", func() {
 		})
 	})
 })
+
+var _ = Describe("Rebuild", func() {
+	var artifact *osbuilder.OSArtifact
+	var r *OSArtifactReconciler
+
+	labelled := metav1.ObjectMeta{Namespace: "default", Labels: map[string]string{artifactLabel: "test"}}
+	named := func(name string) metav1.ObjectMeta {
+		meta := *labelled.DeepCopy()
+		meta.Name = name
+		return meta
+	}
+
+	BeforeEach(func() {
+		artifact = &osbuilder.OSArtifact{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       "test",
+				Namespace:  "default",
+				Generation: 2,
+				Finalizers: []string{FinalizerName},
+			},
+			Spec: osbuilder.OSArtifactSpec{
+				ImageName: "quay.io/kairos/core-opensuse:latest",
+				ISO:       true,
+			},
+		}
+		artifact.Status = osbuilder.OSArtifactStatus{
+			Phase:              osbuilder.Ready,
+			ObservedGeneration: 1,
+			BuildHash:          artifact.Spec.BuildHash(),
+			Artifacts:          []osbuilder.ArtifactFile{{Name: "test.iso", Type: osbuilder.ArtifactISO}},
+			Attempts:           []osbuilder.BuildAttempt{{Attempt: 1, Pod: "test-abcde", Outcome: osbuilder.AttemptSucceeded}},
+		}
+	})
+
+	reconcile := func() {
+		r = &OSArtifactReconciler{Client: newFakeClient(
+			artifact,
+			&corev1.Pod{ObjectMeta: named("test-abcde")},
+			&batchv1.Job{ObjectMeta: named("test-export-0")},
+			&corev1.PersistentVolumeClaim{ObjectMeta: named("test-artifacts")},
+			&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"}},
+		)}
+		_, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(artifact)})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(r.Get(context.TODO(), client.ObjectKeyFromObject(artifact), artifact)).To(Succeed())
+	}
+
+	count := func(list client.ObjectList) int {
+		Expect(r.List(context.TODO(), list, client.InNamespace("default"))).To(Succeed())
+		return meta.LenList(list)
+	}
+
+	It("tears down the previous build when the build inputs change", func() {
+		artifact.Spec.CloudImage = true
+		reconcile()
+
+		Expect(count(&corev1.PodList{})).To(BeZero())
+		Expect(count(&batchv1.JobList{})).To(BeZero())
+		Expect(count(&corev1.PersistentVolumeClaimList{})).To(BeZero())
+		Expect(count(&corev1.ConfigMapList{})).To(BeZero())
+
+		Expect(artifact.Status.Phase).To(BeEquivalentTo(osbuilder.Pending))
+		Expect(artifact.Status.Reason).To(Equal(osbuilder.ReasonSpecChanged))
+		Expect(artifact.Status.ObservedGeneration).To(BeEquivalentTo(2))
+		Expect(artifact.Status.Artifacts).To(BeEmpty())
+		Expect(artifact.Status.Attempts).To(BeEmpty())
+	})
+
+	It("keeps the build when only other fields change", func() {
+		artifact.Spec.Priority = 10
+		artifact.Spec.BuildTimeout = &metav1.Duration{Duration: time.Hour}
+		reconcile()
+
+		Expect(count(&corev1.PodList{})).To(Equal(1))
+		Expect(count(&batchv1.JobList{})).To(Equal(1))
+		Expect(count(&corev1.PersistentVolumeClaimList{})).To(Equal(1))
+		Expect(count(&corev1.ConfigMapList{})).To(Equal(1))
+
+		Expect(artifact.Status.Phase).To(BeEquivalentTo(osbuilder.Ready))
+		Expect(artifact.Status.ObservedGeneration).To(BeEquivalentTo(2))
+		Expect(artifact.Status.Artifacts).To(HaveLen(1))
+	})
+
+	It("only runs the exporters again when they change", func() {
+		artifact.Status.ExportHash = artifact.Spec.ExportHash()
+		artifact.Status.Artifacts[0].URLs = []string{"https://example.com/test.iso"}
+		artifact.Status.Exports = []osbuilder.ExportStatus{{Name: "upload", Phase: osbuilder.ExportSucceeded}}
+		meta.SetStatusCondition(&artifact.Status.Conditions, metav1.Condition{
+			Type:   osbuilder.ConditionBuilt,
+			Status: metav1.ConditionTrue,
+			Reason: osbuilder.ReasonBuildSucceeded,
+		})
+		artifact.Spec.Exporters = []osbuilder.Exporter{{Name: "upload"}}
+		reconcile()
+
+		Expect(count(&corev1.PodList{})).To(Equal(1))
+		Expect(count(&batchv1.JobList{})).To(BeZero())
+		Expect(count(&corev1.PersistentVolumeClaimList{})).To(Equal(1))
+
+		Expect(artifact.Status.Phase).To(BeEquivalentTo(osbuilder.Exporting))
+		Expect(artifact.Status.Reason).To(Equal(osbuilder.ReasonSpecChanged))
+		Expect(artifact.Status.ObservedGeneration).To(BeEquivalentTo(2))
+		Expect(artifact.Status.ExportHash).To(Equal(artifact.Spec.ExportHash()))
+		Expect(artifact.Status.Exports).To(BeEmpty())
+		Expect(artifact.Status.Artifacts).To(HaveLen(1))
+		Expect(artifact.Status.Artifacts[0].URLs).To(BeEmpty())
+	})
+})
@@ -0,0 +1,116 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// jobControllerUIDLabel is set by the job controller on the pods of a job.
+const jobControllerUIDLabel = "controller-uid"
+
+// parseOutputs reads the key=value lines of a termination message. Blank
+// lines, comments and lines without a key are ignored.
+func parseOutputs(message string, outputs map[string]string) {
+	for _, line := range strings.Split(message, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if key = strings.TrimSpace(key); !ok || key == "" {
+			continue
+		}
+		outputs[key] = value
+	}
+}
+
+// jobOutputs collects the outputs of the succeeded pod of a job. It returns
+// nil if the pod is gone or wrote none.
+func (r *OSArtifactReconciler) jobOutputs(ctx context.Context, job *batchv1.Job) (map[string]string, error) {
+	var pods corev1.PodList
+	if err := r.List(ctx, &pods, &client.ListOptions{
+		Namespace: job.Namespace,
+		LabelSelector: labels.SelectorFromSet(labels.Set{
+			jobControllerUIDLabel: string(job.UID),
+		}),
+	}); err != nil {
+		return nil, err
+	}
+
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodSucceeded {
+			continue
+		}
+
+		outputs := map[string]string{}
+		for _, status := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+			if status.State.Terminated != nil {
+				parseOutputs(status.State.Terminated.Message, outputs)
+			}
+		}
+		if len(outputs) == 0 {
+			return nil, nil
+		}
+		return outputs, nil
+	}
+
+	return nil, nil
+}
+
+// collectOutputs fills in the outputs of the succeeded exporters. Outputs
+// already recorded for the same job are kept, as its pods may be gone.
+func (r *OSArtifactReconciler) collectOutputs(ctx context.Context, artifact *osbuilder.OSArtifact, exports []osbuilder.ExportStatus, jobs map[string]*batchv1.Job) error {
+	recorded := map[string]map[string]string{}
+	for _, export := range artifact.Status.Exports {
+		if export.Job != "" && export.Outputs != nil {
+			recorded[export.Job] = export.Outputs
+		}
+	}
+
+	for i := range exports {
+		export := &exports[i]
+		if export.Phase != osbuilder.ExportSucceeded {
+			continue
+		}
+		if outputs, ok := recorded[export.Job]; ok {
+			export.Outputs = outputs
+			continue
+		}
+
+		job := jobs[fmt.Sprintf("%d", i)]
+		if job == nil {
+			// Expired, its outcome was recorded without outputs
+			continue
+		}
+		outputs, err := r.jobOutputs(ctx, job)
+		if err != nil {
+			return err
+		}
+		export.Outputs = outputs
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"context"
+
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("Exporter outputs", func() {
+	var artifact *osbuilder.OSArtifact
+	var job *batchv1.Job
+	var pod *corev1.Pod
+	var r *OSArtifactReconciler
+
+	terminated := func(name, message string) corev1.ContainerStatus {
+		return corev1.ContainerStatus{
+			Name:  name,
+			State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Message: message}},
+		}
+	}
+
+	BeforeEach(func() {
+		artifact = &osbuilder.OSArtifact{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+			Spec:       osbuilder.OSArtifactSpec{Exporters: []osbuilder.Exporter{{Name: "upload"}}},
+		}
+		job = &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "test-export-0", Namespace: "default", UID: "job-uid"}}
+		pod = &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-export-0-abcde",
+				Namespace: "default",
+				Labels:    map[string]string{jobControllerUIDLabel: "job-uid"},
+			},
+			Status: corev1.PodStatus{
+				Phase: corev1.PodSucceeded,
+				InitContainerStatuses: []corev1.ContainerStatus{
+					terminated("prepare", "checksum=abc\nurl=https://example.com/old.iso"),
+				},
+				ContainerStatuses: []corev1.ContainerStatus{
+					terminated("upload", "# uploaded\n\nurl=https://example.com/test.iso?a=b\nnot an output\n"),
+				},
+			},
+		}
+	})
+
+	build := func(objects ...client.Object) {
+		r = &OSArtifactReconciler{Client: newFakeClient(objects...)}
+	}
+
+	It("collects the key=value lines of the succeeded pod", func() {
+		build(job, pod)
+
+		exports := []osbuilder.ExportStatus{{Name: "upload", Job: job.Name, Phase: osbuilder.ExportSucceeded}}
+		Expect(r.collectOutputs(context.TODO(), artifact, exports, map[string]*batchv1.Job{"0": job})).To(Succeed())
+		Expect(exports[0].Outputs).To(Equal(map[string]string{
+			"checksum": "abc",
+			"url":      "https://example.com/test.iso?a=b",
+		}))
+	})
+
+	It("keeps the outputs recorded for the job once its pods are gone", func() {
+		build(job)
+		artifact.Status.Exports = []osbuilder.ExportStatus{{
+			Name: "upload", Job: job.Name, Phase: osbuilder.ExportSucceeded,
+			Outputs: map[string]string{"url": "https://example.com/test.iso"},
+		}}
+
+		exports := []osbuilder.ExportStatus{{Name: "upload", Job: job.Name, Phase: osbuilder.ExportSucceeded}}
+		Expect(r.collectOutputs(context.TODO(), artifact, exports, map[string]*batchv1.Job{"0": job})).To(Succeed())
+		Expect(exports[0].Outputs).To(HaveKeyWithValue("url", "https://example.com/test.iso"))
+	})
+
+	It("ignores pods that did not succeed", func() {
+		pod.Status.Phase = corev1.PodFailed
+		build(job, pod)
+
+		exports := []osbuilder.ExportStatus{{Name: "upload", Job: job.Name, Phase: osbuilder.ExportSucceeded}}
+		Expect(r.collectOutputs(context.TODO(), artifact, exports, map[string]*batchv1.Job{"0": job})).To(Succeed())
+		Expect(exports[0].Outputs).To(BeNil())
+	})
+
+	It("tells the exporter containers where to write their outputs", func() {
+		podSpec := &corev1.PodSpec{Containers: []corev1.Container{
+			{Name: "upload"},
+			{Name: "notify", TerminationMessagePath: "/tmp/outputs"},
+		}}
+		injectArtifactMetadata(podSpec, artifact)
+
+		Expect(podSpec.Containers[0].Env).To(ContainElement(corev1.EnvVar{Name: "OSBUILDER_OUTPUTS", Value: "/dev/termination-log"}))
+		Expect(podSpec.Containers[1].Env).To(ContainElement(corev1.EnvVar{Name: "OSBUILDER_OUTPUTS", Value: "/tmp/outputs"}))
+	})
+})
@@ -0,0 +1,166 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	pushImageContainerName = "push-image"
+
+	// DefaultPushImage provides crane, which pushes the packed image.
+	DefaultPushImage = "gcr.io/go-containerregistry/crane:debug"
+)
+
+// pushImageScript pushes the tarball packed by create-image, tags the pushed
+// manifest and writes its digest reference to the termination log, where
+// checkBuild collects it.
+const pushImageScript = `ref=$(crane push $INSECURE "/artifacts/$ARTIFACT.tar" "$DESTINATION")
+for tag in $TAGS; do
+  crane tag $INSECURE "$ref" "$tag"
+done
+printf '%s' "$ref" > /dev/termination-log
+if [ -d /pushed ]; then printf '%s' "$ref" > /pushed/ref; fi
+`
+
+func pushImageContainer(containerImage string, artifact *osbuilder.OSArtifact) corev1.Container {
+	push := artifact.Spec.Push
+
+	env := []corev1.EnvVar{
+		{Name: "ARTIFACT", Value: artifact.Name},
+		{Name: "DESTINATION", Value: push.Destination},
+		{Name: "TAGS", Value: strings.Join(push.Tags, " ")},
+	}
+	if push.Insecure {
+		env = append(env, corev1.EnvVar{Name: "INSECURE", Value: "--insecure"})
+	}
+
+	volumeMounts := []corev1.VolumeMount{
+		{
+			Name:      "artifacts",
+			MountPath: "/artifacts",
+			ReadOnly:  true,
+		},
+	}
+	if push.CredentialsSecretRef != nil {
+		env = append(env, corev1.EnvVar{Name: "DOCKER_CONFIG", Value: "/push/docker"})
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      "push-credentials",
+			MountPath: "/push/docker",
+			ReadOnly:  true,
+		})
+	}
+	if push.CARef != nil {
+		// Go reads the system roots file along with every file in these
+		// directories.
+		env = append(env, corev1.EnvVar{Name: "SSL_CERT_DIR", Value: "/push/ca:/etc/ssl/certs"})
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      "push-ca",
+			MountPath: "/push/ca",
+			ReadOnly:  true,
+		})
+	}
+
+	return corev1.Container{
+		ImagePullPolicy:          corev1.PullAlways,
+		Name:                     pushImageContainerName,
+		Image:                    containerImage,
+		Command:                  []string{"/busybox/sh", "-cxe"},
+		Args:                     []string{pushImageScript},
+		Env:                      env,
+		TerminationMessagePolicy: corev1.TerminationMessageReadFile,
+		VolumeMounts:             volumeMounts,
+	}
+}
+
+// pushImage returns the image the push-image container runs.
+func (r *OSArtifactReconciler) pushImage() string {
+	if r.PushImage != "" {
+		return r.PushImage
+	}
+	return DefaultPushImage
+}
+
+// pushVolumes returns the volumes holding the registry credentials and CA of
+// push, named after prefix.
+func pushVolumes(prefix string, push *osbuilder.PushSpec) []corev1.Volume {
+	var volumes []corev1.Volume
+	if push.CredentialsSecretRef != nil {
+		volumes = append(volumes, corev1.Volume{
+			Name: prefix + "-credentials",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: push.CredentialsSecretRef.Name,
+					Items: []corev1.KeyToPath{
+						{Key: corev1.DockerConfigJsonKey, Path: "config.json"},
+					},
+				},
+			},
+		})
+	}
+	if push.CARef != nil {
+		volumes = append(volumes, corev1.Volume{
+			Name: prefix + "-ca",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: push.CARef.Name,
+					Items: []corev1.KeyToPath{
+						{Key: push.CARef.Key, Path: "ca.crt"},
+					},
+				},
+			},
+		})
+	}
+
+	return volumes
+}
+
+// pushedImage reads the digest reference the container of a succeeded builder
+// pod pushed to push. It returns nil if the pod did not push anything.
+func pushedImage(pod *corev1.Pod, containerName string, push *osbuilder.PushSpec) (*osbuilder.PushStatus, error) {
+	if push == nil {
+		return nil, nil
+	}
+
+	for _, status := range pod.Status.InitContainerStatuses {
+		if status.Name != containerName {
+			continue
+		}
+		if status.State.Terminated == nil {
+			return nil, fmt.Errorf("container %s has not terminated", status.Name)
+		}
+
+		ref := strings.TrimSpace(status.State.Terminated.Message)
+		image, digest, ok := strings.Cut(ref, "@")
+		if !ok {
+			return nil, fmt.Errorf("container %s reported %q instead of a digest reference", status.Name, ref)
+		}
+
+		return &osbuilder.PushStatus{
+			Image:  image,
+			Digest: digest,
+			Tags:   append([]string{}, push.Tags...),
+		}, nil
+	}
+
+	return nil, nil
+}
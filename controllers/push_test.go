@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Push", func() {
+	var artifact *osbuilder.OSArtifact
+
+	BeforeEach(func() {
+		artifact = &osbuilder.OSArtifact{
+			ObjectMeta: metav1.ObjectMeta{Name: "test"},
+			Spec: osbuilder.OSArtifactSpec{
+				ImageName: "quay.io/kairos/core-opensuse:latest",
+				Push: &osbuilder.PushSpec{
+					Destination:          "localhost:5000/kairos/custom:v1",
+					Tags:                 []string{"latest", "stable"},
+					CredentialsSecretRef: &corev1.LocalObjectReference{Name: "registry"},
+					CARef:                &osbuilder.SecretKeySelector{Name: "registry-ca"},
+				},
+			},
+		}
+	})
+
+	It("pushes after packing the image", func() {
+		r := &OSArtifactReconciler{ToolImage: "quay.io/kairos/auroraboot:latest"}
+		pod := r.newBuilderPod("test-artifacts", artifact)
+
+		var names []string
+		for _, container := range pod.Spec.InitContainers {
+			names = append(names, container.Name)
+		}
+		Expect(names[len(names)-3:]).To(Equal([]string{"create-image", writeChecksumsContainerName, pushImageContainerName}))
+
+		push := pod.Spec.InitContainers[len(names)-1]
+		Expect(push.Image).To(Equal(DefaultPushImage))
+		Expect(push.Env).To(ContainElements(
+			corev1.EnvVar{Name: "DESTINATION", Value: "localhost:5000/kairos/custom:v1"},
+			corev1.EnvVar{Name: "TAGS", Value: "latest stable"},
+			corev1.EnvVar{Name: "DOCKER_CONFIG", Value: "/push/docker"},
+		))
+
+		var volumes []string
+		for _, volume := range pod.Spec.Volumes {
+			volumes = append(volumes, volume.Name)
+			if volume.Name == "push-ca" {
+				Expect(volume.Secret.Items[0].Key).To(Equal(osbuilder.DefaultCAKey))
+			}
+		}
+		Expect(volumes).To(ContainElements("push-credentials", "push-ca"))
+	})
+
+	It("reads the pushed digest", func() {
+		pod := &corev1.Pod{
+			Status: corev1.PodStatus{
+				InitContainerStatuses: []corev1.ContainerStatus{{
+					Name: pushImageContainerName,
+					State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+						Message: "localhost:5000/kairos/custom@sha256:abc\n",
+					}},
+				}},
+			},
+		}
+
+		push, err := pushedImage(pod, pushImageContainerName, artifact.Spec.Push)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(push).To(Equal(&osbuilder.PushStatus{
+			Image:  "localhost:5000/kairos/custom",
+			Digest: "sha256:abc",
+			Tags:   []string{"latest", "stable"},
+		}))
+
+		push, err = pushedImage(pod, pushImageContainerName, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(push).To(BeNil())
+	})
+})
@@ -0,0 +1,157 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// queueRecheckInterval is how often a queued artifact checks whether a build
+// slot was freed.
+const queueRecheckInterval = 10 * time.Second
+
+// limitsBuilds reports whether the operator limits concurrent builds.
+func (r *OSArtifactReconciler) limitsBuilds() bool {
+	return r.MaxConcurrentBuilds > 0 || r.MaxConcurrentBuildsPerNamespace > 0
+}
+
+// buildQueuePosition returns the queue position of an artifact about to start
+// a new build, or 0 if a build slot is free for it.
+func (r *OSArtifactReconciler) buildQueuePosition(ctx context.Context, artifact *osbuilder.OSArtifact) (int32, error) {
+	if !r.limitsBuilds() {
+		return 0, nil
+	}
+
+	var artifacts osbuilder.OSArtifactList
+	if err := r.List(ctx, &artifacts); err != nil {
+		return 0, err
+	}
+
+	// The cached status of an artifact admitted by the previous reconcile
+	// may not say Building yet, its builder pod does.
+	running, err := r.runningBuilds(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for i := range artifacts.Items {
+		if running[client.ObjectKeyFromObject(&artifacts.Items[i])] {
+			artifacts.Items[i].Status.Phase = osbuilder.Building
+		}
+	}
+
+	return queuePosition(artifact, artifacts.Items, r.MaxConcurrentBuilds, r.MaxConcurrentBuildsPerNamespace), nil
+}
+
+// runningBuilds returns the artifacts with a builder pod that has not
+// finished, read from the API server rather than the cache.
+func (r *OSArtifactReconciler) runningBuilds(ctx context.Context) (map[types.NamespacedName]bool, error) {
+	reader := r.APIReader
+	if reader == nil {
+		reader = r.Client
+	}
+
+	var pods corev1.PodList
+	if err := reader.List(ctx, &pods, client.HasLabels{artifactLabel, attemptLabel}); err != nil {
+		return nil, err
+	}
+
+	running := map[types.NamespacedName]bool{}
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp != nil || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		running[types.NamespacedName{Namespace: pod.Namespace, Name: pod.Labels[artifactLabel]}] = true
+	}
+
+	return running, nil
+}
+
+// waitsForBuild reports whether an artifact is waiting for its build to start.
+func waitsForBuild(artifact *osbuilder.OSArtifact) bool {
+	switch artifact.Status.Phase {
+	case "", osbuilder.Pending, osbuilder.Queued:
+		return artifact.DeletionTimestamp == nil
+	}
+	return false
+}
+
+// queuePosition hands the free build slots to the waiting artifacts by
+// priority, then creation time, and returns the position of candidate among
+// the artifacts left waiting, or 0 if it gets a slot. An artifact whose
+// namespace is at its limit does not hold back the others. A limit of 0 is
+// unlimited.
+func queuePosition(candidate *osbuilder.OSArtifact, artifacts []osbuilder.OSArtifact, maxBuilds, maxBuildsPerNamespace int) int32 {
+	var building int
+	buildingIn := map[string]int{}
+	var waiting []*osbuilder.OSArtifact
+	for i := range artifacts {
+		artifact := &artifacts[i]
+		if artifact.UID == candidate.UID {
+			continue
+		}
+		switch {
+		case artifact.Status.Phase == osbuilder.Building:
+			building++
+			buildingIn[artifact.Namespace]++
+		case waitsForBuild(artifact):
+			waiting = append(waiting, artifact)
+		}
+	}
+	waiting = append(waiting, candidate)
+
+	sort.SliceStable(waiting, func(i, j int) bool {
+		a, b := waiting[i], waiting[j]
+		if a.Spec.Priority != b.Spec.Priority {
+			return a.Spec.Priority > b.Spec.Priority
+		}
+		if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+			return a.CreationTimestamp.Before(&b.CreationTimestamp)
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+
+	var position int32
+	for _, artifact := range waiting {
+		free := (maxBuilds == 0 || building < maxBuilds) &&
+			(maxBuildsPerNamespace == 0 || buildingIn[artifact.Namespace] < maxBuildsPerNamespace)
+		if free {
+			building++
+			buildingIn[artifact.Namespace]++
+		} else {
+			position++
+		}
+
+		if artifact == candidate {
+			if free {
+				return 0
+			}
+			return position
+		}
+	}
+
+	return position
+}
@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("Queue", func() {
+	created := time.Now()
+	newArtifact := func(namespace, name string, phase osbuilder.ArtifactPhase) osbuilder.OSArtifact {
+		created = created.Add(time.Second)
+		return osbuilder.OSArtifact{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         namespace,
+				UID:               types.UID(namespace + "/" + name),
+				CreationTimestamp: metav1.NewTime(created),
+			},
+			Status: osbuilder.OSArtifactStatus{Phase: phase},
+		}
+	}
+
+	var artifacts []osbuilder.OSArtifact
+
+	BeforeEach(func() {
+		artifacts = []osbuilder.OSArtifact{
+			newArtifact("a", "running", osbuilder.Building),
+			newArtifact("a", "first", osbuilder.Queued),
+			newArtifact("b", "second", osbuilder.Queued),
+			newArtifact("a", "third", osbuilder.Pending),
+			newArtifact("b", "done", osbuilder.Ready),
+		}
+	})
+
+	It("admits everything without limits", func() {
+		Expect(queuePosition(&artifacts[3], artifacts, 0, 0)).To(BeZero())
+	})
+
+	It("hands free slots out in creation order", func() {
+		Expect(queuePosition(&artifacts[1], artifacts, 2, 0)).To(BeZero())
+		Expect(queuePosition(&artifacts[2], artifacts, 2, 0)).To(BeEquivalentTo(1))
+		Expect(queuePosition(&artifacts[3], artifacts, 2, 0)).To(BeEquivalentTo(2))
+	})
+
+	It("lets other namespaces pass a namespace at its limit", func() {
+		Expect(queuePosition(&artifacts[1], artifacts, 0, 1)).To(BeEquivalentTo(1))
+		Expect(queuePosition(&artifacts[2], artifacts, 0, 1)).To(BeZero())
+		Expect(queuePosition(&artifacts[3], artifacts, 0, 1)).To(BeEquivalentTo(2))
+	})
+
+	It("builds higher priorities first", func() {
+		artifacts[3].Spec.Priority = 10
+		Expect(queuePosition(&artifacts[3], artifacts, 2, 0)).To(BeZero())
+		Expect(queuePosition(&artifacts[1], artifacts, 2, 0)).To(BeEquivalentTo(1))
+	})
+
+	It("admits one candidate at a time while the cache lags behind", func() {
+		first := newArtifact("a", "first", osbuilder.Pending)
+		second := newArtifact("b", "second", osbuilder.Pending)
+		for _, artifact := range []*osbuilder.OSArtifact{&first, &second} {
+			artifact.Spec = osbuilder.OSArtifactSpec{ImageName: "quay.io/kairos/core-opensuse:latest", ISO: true}
+		}
+		r := &OSArtifactReconciler{
+			Client:              newFakeClient(&first, &second),
+			ToolImage:           "quay.io/kairos/auroraboot:latest",
+			MaxConcurrentBuilds: 1,
+		}
+
+		_, err := r.startBuild(context.TODO(), &first)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(first.Status.Phase).To(BeEquivalentTo(osbuilder.Building))
+
+		// The status of the first build has not reached the cache yet, and
+		// the second one would be admitted ahead of it.
+		first.Status.Phase = osbuilder.Pending
+		Expect(r.Status().Update(context.TODO(), &first)).To(Succeed())
+		second.Spec.Priority = 10
+
+		_, err = r.startBuild(context.TODO(), &second)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(second.Status.Phase).To(BeEquivalentTo(osbuilder.Queued))
+		Expect(second.Status.QueuePosition).To(BeEquivalentTo(1))
+
+		var pods corev1.PodList
+		Expect(r.List(context.TODO(), &pods)).To(Succeed())
+		Expect(pods.Items).To(HaveLen(1))
+		Expect(pods.Items[0].Namespace).To(Equal("a"))
+	})
+})
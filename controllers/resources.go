@@ -0,0 +1,95 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// LoadBuildResources reads the default build resources of the operator from
+// a YAML file holding a BuildResources object.
+func LoadBuildResources(path string) (*osbuilder.BuildResources, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := &osbuilder.BuildResources{}
+	if err := yaml.UnmarshalStrict(data, resources); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	return resources, nil
+}
+
+// stepResources returns the resources set for the build step a container
+// belongs to, if any.
+func stepResources(resources *osbuilder.BuildResources, container string) *corev1.ResourceRequirements {
+	if resources == nil {
+		return nil
+	}
+
+	switch {
+	case strings.HasPrefix(container, "pull-image-"):
+		return resources.Unpack
+	case container == "kaniko-build":
+		return resources.Kaniko
+	case container == "build-iso", container == "build-netboot":
+		return resources.ISO
+	case container == "build-cloud-image", container == "build-azure-cloud-image", container == "build-gce-cloud-image":
+		return resources.CloudImage
+	}
+
+	return nil
+}
+
+// containerResources resolves the resources of a builder container, from the
+// most to the least specific setting: the step and default of the artifact,
+// then the step and default of the operator.
+func (r *OSArtifactReconciler) containerResources(artifact *osbuilder.OSArtifact, container string) *corev1.ResourceRequirements {
+	if resources := stepResources(artifact.Spec.Resources, container); resources != nil {
+		return resources
+	}
+	if artifact.Spec.Resources != nil && artifact.Spec.Resources.Default != nil {
+		return artifact.Spec.Resources.Default
+	}
+	if resources := stepResources(r.BuildResources, container); resources != nil {
+		return resources
+	}
+	if r.BuildResources != nil {
+		return r.BuildResources.Default
+	}
+
+	return nil
+}
+
+// applyResources sets the resources of every container of the builder pod.
+func (r *OSArtifactReconciler) applyResources(podSpec *corev1.PodSpec, artifact *osbuilder.OSArtifact) {
+	for _, containers := range [][]corev1.Container{podSpec.InitContainers, podSpec.Containers} {
+		for i := range containers {
+			if resources := r.containerResources(artifact, containers[i].Name); resources != nil {
+				containers[i].Resources = *resources.DeepCopy()
+			}
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"os"
+	"path/filepath"
+
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Resources", func() {
+	memory := func(quantity string) *corev1.ResourceRequirements {
+		return &corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse(quantity)},
+		}
+	}
+
+	It("prefers the artifact settings over the operator defaults", func() {
+		r := &OSArtifactReconciler{
+			ToolImage: "quay.io/kairos/auroraboot:latest",
+			BuildResources: &osbuilder.BuildResources{
+				Default: memory("1Gi"),
+				ISO:     memory("4Gi"),
+			},
+		}
+		artifact := &osbuilder.OSArtifact{
+			ObjectMeta: metav1.ObjectMeta{Name: "test"},
+			Spec: osbuilder.OSArtifactSpec{
+				ImageName: "quay.io/kairos/core-opensuse:latest",
+				ISO:       true,
+				Resources: &osbuilder.BuildResources{Unpack: memory("2Gi")},
+			},
+		}
+
+		pod := r.newBuilderPod("test-artifacts", artifact)
+		limits := map[string]string{}
+		for _, container := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+			limits[container.Name] = container.Resources.Limits.Memory().String()
+		}
+		Expect(limits).To(HaveKeyWithValue("pull-image-baseimage", "2Gi"))
+		Expect(limits).To(HaveKeyWithValue("build-iso", "4Gi"))
+		Expect(limits).To(HaveKeyWithValue("create-image", "1Gi"))
+	})
+
+	It("loads the operator defaults from a file", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "resources.yaml")
+		Expect(os.WriteFile(path, []byte("kaniko:\n  requests:\n    cpu: \"2\"\n"), 0o600)).To(Succeed())
+
+		resources, err := LoadBuildResources(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resources.Kaniko.Requests.Cpu().String()).To(Equal("2"))
+
+		Expect(os.WriteFile(path, []byte("kanico: {}\n"), 0o600)).To(Succeed())
+		_, err = LoadBuildResources(path)
+		Expect(err).To(HaveOccurred())
+	})
+})
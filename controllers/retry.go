@@ -0,0 +1,149 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	attemptLabel = "build.kairos.io/attempt"
+
+	// maxRetryBackoff caps the exponential backoff between build attempts.
+	maxRetryBackoff = 10 * time.Minute
+)
+
+// currentAttempt returns the latest build attempt, or nil if none was
+// recorded for the current generation.
+func currentAttempt(artifact *osbuilder.OSArtifact) *osbuilder.BuildAttempt {
+	if len(artifact.Status.Attempts) == 0 {
+		return nil
+	}
+	return &artifact.Status.Attempts[len(artifact.Status.Attempts)-1]
+}
+
+// nextAttempt returns the number of the attempt startBuild would create. A
+// build that is not in progress starts over at 1.
+func nextAttempt(artifact *osbuilder.OSArtifact) int32 {
+	current := currentAttempt(artifact)
+	if current == nil || artifact.Status.Phase != osbuilder.Building {
+		return 1
+	}
+	return current.Attempt + 1
+}
+
+// builderPodName names the builder pod of an attempt, so that creating it
+// twice for the same attempt fails instead of starting a second build.
+func builderPodName(artifact *osbuilder.OSArtifact, attempt int32) string {
+	return fmt.Sprintf("%s-build-%d-%d", artifact.Name, artifact.Generation, attempt)
+}
+
+// podAttempt returns the attempt a builder pod was created for. Pods created
+// before attempts were tracked belong to attempt 0.
+func podAttempt(pod *corev1.Pod) int32 {
+	attempt, err := strconv.ParseInt(pod.Labels[attemptLabel], 10, 32)
+	if err != nil {
+		return 0
+	}
+	return int32(attempt)
+}
+
+// startAttempt records a new attempt running in pod.
+func startAttempt(artifact *osbuilder.OSArtifact, attempt int32, pod *corev1.Pod) {
+	now := metav1.Now()
+	artifact.Status.Attempts = append(artifact.Status.Attempts, osbuilder.BuildAttempt{
+		Attempt:   attempt,
+		Pod:       pod.Name,
+		Outcome:   osbuilder.AttemptRunning,
+		StartTime: &now,
+	})
+}
+
+// finishAttempt records the outcome of the current attempt.
+func finishAttempt(artifact *osbuilder.OSArtifact, outcome osbuilder.AttemptOutcome, reason, message string) {
+	current := currentAttempt(artifact)
+	if current == nil {
+		return
+	}
+
+	now := metav1.Now()
+	current.Outcome = outcome
+	current.CompletionTime = &now
+	current.Reason = reason
+	current.Message = message
+}
+
+// retryPolicy returns the retry policy of the artifact with its defaults
+// applied. Artifacts without a policy are built once.
+func retryPolicy(artifact *osbuilder.OSArtifact) osbuilder.RetryPolicy {
+	policy := osbuilder.RetryPolicy{MaxAttempts: 1}
+	if artifact.Spec.RetryPolicy != nil {
+		policy = *artifact.Spec.RetryPolicy.DeepCopy()
+	}
+	policy.Default()
+
+	return policy
+}
+
+// shouldRetry reports whether the current attempt, which failed with reason,
+// is followed by another one.
+func shouldRetry(artifact *osbuilder.OSArtifact, reason string) bool {
+	current := currentAttempt(artifact)
+	policy := retryPolicy(artifact)
+	if current == nil || current.Attempt >= policy.MaxAttempts {
+		return false
+	}
+
+	for _, retryOn := range policy.RetryOn {
+		if string(retryOn) == reason {
+			return true
+		}
+	}
+
+	return false
+}
+
+// retryBackoff returns how long to wait after the given attempt failed. The
+// backoff doubles after every attempt, up to maxRetryBackoff.
+func retryBackoff(artifact *osbuilder.OSArtifact, attempt int32) time.Duration {
+	backoff := retryPolicy(artifact).Backoff.Duration
+	for i := int32(1); i < attempt && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRetryBackoff {
+		backoff = maxRetryBackoff
+	}
+
+	return backoff
+}
+
+// retryDelay returns how much longer to wait before retrying the current
+// attempt, which has failed.
+func retryDelay(artifact *osbuilder.OSArtifact) time.Duration {
+	current := currentAttempt(artifact)
+	if current == nil || current.CompletionTime == nil {
+		return 0
+	}
+
+	return time.Until(current.CompletionTime.Add(retryBackoff(artifact, current.Attempt)))
+}
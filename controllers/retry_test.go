@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Retry", func() {
+	var artifact *osbuilder.OSArtifact
+	var pod *corev1.Pod
+
+	BeforeEach(func() {
+		artifact = &osbuilder.OSArtifact{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Generation: 1},
+			Spec: osbuilder.OSArtifactSpec{
+				RetryPolicy: &osbuilder.RetryPolicy{
+					MaxAttempts: 3,
+					Backoff:     &metav1.Duration{Duration: time.Minute},
+				},
+			},
+		}
+		pod = &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "test-abcde"}}
+		markBuilding(artifact)
+		startAttempt(artifact, nextAttempt(artifact), pod)
+	})
+
+	It("does not retry without a retry policy", func() {
+		artifact.Spec.RetryPolicy = nil
+		finishAttempt(artifact, osbuilder.AttemptFailed, osbuilder.ReasonEvicted, "")
+
+		Expect(shouldRetry(artifact, osbuilder.ReasonEvicted)).To(BeFalse())
+	})
+
+	It("retries the listed reasons until attempts run out", func() {
+		finishAttempt(artifact, osbuilder.AttemptFailed, osbuilder.ReasonResolutionFailed, "registry timeout")
+		Expect(shouldRetry(artifact, osbuilder.ReasonResolutionFailed)).To(BeTrue())
+		Expect(shouldRetry(artifact, osbuilder.ReasonBuildFailed)).To(BeFalse())
+
+		Expect(nextAttempt(artifact)).To(BeEquivalentTo(2))
+		startAttempt(artifact, nextAttempt(artifact), pod)
+		finishAttempt(artifact, osbuilder.AttemptFailed, osbuilder.ReasonEvicted, "")
+		startAttempt(artifact, nextAttempt(artifact), pod)
+		finishAttempt(artifact, osbuilder.AttemptFailed, osbuilder.ReasonEvicted, "")
+		Expect(shouldRetry(artifact, osbuilder.ReasonEvicted)).To(BeFalse())
+
+		Expect(artifact.Status.Attempts).To(HaveLen(3))
+		Expect(artifact.Status.Attempts[0].Reason).To(Equal(osbuilder.ReasonResolutionFailed))
+		Expect(artifact.Status.Attempts[0].Message).To(Equal("registry timeout"))
+	})
+
+	It("doubles the backoff up to ten minutes", func() {
+		Expect(retryBackoff(artifact, 1)).To(Equal(time.Minute))
+		Expect(retryBackoff(artifact, 2)).To(Equal(2 * time.Minute))
+		Expect(retryBackoff(artifact, 5)).To(Equal(10 * time.Minute))
+	})
+
+	It("reads the attempt from the pod label", func() {
+		Expect(podAttempt(pod)).To(BeEquivalentTo(0))
+		pod.Labels = map[string]string{attemptLabel: "2"}
+		Expect(podAttempt(pod)).To(BeEquivalentTo(2))
+	})
+
+	It("starts a single builder pod per attempt from a stale status", func() {
+		artifact := &osbuilder.OSArtifact{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default", Generation: 2},
+			Spec: osbuilder.OSArtifactSpec{
+				ImageName: "quay.io/kairos/core-opensuse:latest",
+				ISO:       true,
+			},
+		}
+		r := &OSArtifactReconciler{
+			Client:    newFakeClient(artifact),
+			ToolImage: "quay.io/kairos/auroraboot:latest",
+		}
+
+		// The second reconcile sees the status from before the first one
+		// recorded its builder pod.
+		stale := artifact.DeepCopy()
+		_, err := r.startBuild(context.TODO(), artifact)
+		Expect(err).ToNot(HaveOccurred())
+		_, _ = r.startBuild(context.TODO(), stale)
+
+		var pods corev1.PodList
+		Expect(r.List(context.TODO(), &pods)).To(Succeed())
+		Expect(pods.Items).To(HaveLen(1))
+		Expect(pods.Items[0].Name).To(Equal("test-build-2-1"))
+		Expect(artifact.Status.Attempts).To(HaveLen(1))
+		Expect(artifact.Status.Attempts[0].Pod).To(Equal("test-build-2-1"))
+	})
+})
@@ -0,0 +1,206 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	s3UploadContainerName = "s3-upload"
+
+	// DefaultS3Image provides the AWS CLI, which uploads artifacts to S3.
+	DefaultS3Image = "amazon/aws-cli:latest"
+)
+
+// s3Upload is a file of the artifacts volume and the key it is uploaded to.
+type s3Upload struct {
+	File string
+	Key  string
+	URL  string
+}
+
+// s3Uploads lists the files of the artifact the exporter uploads.
+func s3Uploads(artifact *osbuilder.OSArtifact, exporter *osbuilder.S3Exporter, generation int64) ([]s3Upload, error) {
+	var uploads []s3Upload
+	for _, file := range artifact.Status.Artifacts {
+		if !exporter.Uploads(file.Type) {
+			continue
+		}
+
+		key, err := exporter.ObjectKey(osbuilder.S3PathData{
+			Namespace:  artifact.Namespace,
+			Name:       artifact.Name,
+			Generation: generation,
+			File:       file.Name,
+			Type:       file.Type,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("rendering the key of %s: %w", file.Name, err)
+		}
+
+		uploads = append(uploads, s3Upload{File: file.Name, Key: key, URL: exporter.ObjectURL(key)})
+	}
+
+	return uploads, nil
+}
+
+// s3UploadScript configures the AWS CLI and copies every upload to the
+// bucket.
+func s3UploadScript(exporter *osbuilder.S3Exporter, uploads []s3Upload) string {
+	var script strings.Builder
+	if exporter.ForcePathStyle {
+		script.WriteString("aws configure set default.s3.addressing_style path\n")
+	}
+	if exporter.MultipartThreshold != nil {
+		fmt.Fprintf(&script, "aws configure set default.s3.multipart_threshold %d\n", exporter.MultipartThreshold.Value())
+	}
+	if exporter.MultipartChunkSize != nil {
+		fmt.Fprintf(&script, "aws configure set default.s3.multipart_chunksize %d\n", exporter.MultipartChunkSize.Value())
+	}
+
+	var endpoint string
+	if exporter.Endpoint != "" {
+		endpoint = " --endpoint-url " + shellQuote(exporter.Endpoint)
+	}
+	for _, upload := range uploads {
+		fmt.Fprintf(&script, "aws s3 cp%s %s %s\n", endpoint,
+			shellQuote("/artifacts/"+upload.File),
+			shellQuote("s3://"+exporter.Bucket+"/"+upload.Key))
+	}
+
+	return script.String()
+}
+
+// shellQuote quotes s as a single shell word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// s3JobSpec returns the job uploading the artifacts to the bucket of the
+// exporter.
+func (r *OSArtifactReconciler) s3JobSpec(artifact *osbuilder.OSArtifact, exporter *osbuilder.S3Exporter) (batchv1.JobSpec, error) {
+	uploads, err := s3Uploads(artifact, exporter, artifact.Status.ObservedGeneration)
+	if err != nil {
+		return batchv1.JobSpec{}, err
+	}
+
+	container := corev1.Container{
+		ImagePullPolicy: corev1.PullAlways,
+		Name:            s3UploadContainerName,
+		Image:           r.s3Image(),
+		Command:         []string{"/bin/bash", "-cxe"},
+		Args:            []string{s3UploadScript(exporter, uploads)},
+		Env: []corev1.EnvVar{
+			{Name: "AWS_DEFAULT_REGION", Value: exporter.Region},
+			// The image has no writable home to store the configuration in.
+			{Name: "AWS_CONFIG_FILE", Value: "/tmp/aws/config"},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      "artifacts",
+				MountPath: "/artifacts",
+				ReadOnly:  true,
+			},
+		},
+	}
+	if exporter.CredentialsSecretRef != nil {
+		container.EnvFrom = []corev1.EnvFromSource{
+			{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: *exporter.CredentialsSecretRef}},
+		}
+	}
+
+	return batchv1.JobSpec{
+		Template: corev1.PodTemplateSpec{
+			Spec: corev1.PodSpec{
+				RestartPolicy: corev1.RestartPolicyNever,
+				Containers:    []corev1.Container{container},
+			},
+		},
+	}, nil
+}
+
+// exporterJobSpec returns the job spec of the i-th exporter.
+func (r *OSArtifactReconciler) exporterJobSpec(artifact *osbuilder.OSArtifact, i int) (batchv1.JobSpec, error) {
+	exporter := &artifact.Spec.Exporters[i]
+	if exporter.S3 != nil {
+		return r.s3JobSpec(artifact, exporter.S3)
+	}
+	return exporter.JobSpec(), nil
+}
+
+// s3Image returns the image the s3-upload container runs.
+func (r *OSArtifactReconciler) s3Image() string {
+	if r.S3Image != "" {
+		return r.S3Image
+	}
+	return DefaultS3Image
+}
+
+// recordS3URLs adds the URLs of the objects uploaded by the succeeded S3
+// exporters to status.artifacts, given the exporter jobs by export index. The
+// keys are rendered for the generation the job was created for.
+func recordS3URLs(artifact *osbuilder.OSArtifact, jobs map[string]*batchv1.Job) error {
+	urls := map[string][]string{}
+	for i := range artifact.Spec.Exporters {
+		exporter := artifact.Spec.Exporters[i].S3
+		if exporter == nil || i >= len(artifact.Status.Exports) || artifact.Status.Exports[i].Phase != osbuilder.ExportSucceeded {
+			continue
+		}
+
+		generation := artifact.Status.ObservedGeneration
+		if job := jobs[fmt.Sprintf("%d", i)]; job != nil {
+			if g, err := strconv.ParseInt(job.Annotations[artifactGenerationAnnotation], 10, 64); err == nil {
+				generation = g
+			}
+		}
+
+		uploads, err := s3Uploads(artifact, exporter, generation)
+		if err != nil {
+			return err
+		}
+		for _, upload := range uploads {
+			urls[upload.File] = append(urls[upload.File], upload.URL)
+		}
+	}
+
+	for i := range artifact.Status.Artifacts {
+		file := &artifact.Status.Artifacts[i]
+		for _, url := range urls[file.Name] {
+			if !containsString(file.URLs, url) {
+				file.URLs = append(file.URLs, url)
+			}
+		}
+	}
+
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("S3 exporter", func() {
+	var artifact *osbuilder.OSArtifact
+
+	BeforeEach(func() {
+		threshold := resource.MustParse("64Mi")
+		artifact = &osbuilder.OSArtifact{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default", Generation: 2},
+			Spec: osbuilder.OSArtifactSpec{
+				Exporters: []osbuilder.Exporter{{
+					S3: &osbuilder.S3Exporter{
+						Bucket:               "artifacts",
+						Prefix:               "kairos",
+						Path:                 osbuilder.DefaultS3Path,
+						Endpoint:             "http://minio:9000",
+						Region:               osbuilder.DefaultS3Region,
+						ForcePathStyle:       true,
+						CredentialsSecretRef: &corev1.LocalObjectReference{Name: "minio"},
+						Types:                []osbuilder.ArtifactType{osbuilder.ArtifactISO},
+						MultipartThreshold:   &threshold,
+					},
+				}},
+			},
+			Status: osbuilder.OSArtifactStatus{
+				ObservedGeneration: 2,
+				Exports:            []osbuilder.ExportStatus{{Name: "0", Job: "test-export-0", Phase: osbuilder.ExportSucceeded}},
+				Artifacts: []osbuilder.ArtifactFile{
+					{Name: "test.iso", Type: osbuilder.ArtifactISO},
+					{Name: "test.iso.sha256", Type: osbuilder.ArtifactChecksum},
+				},
+			},
+		}
+	})
+
+	It("uploads the selected files", func() {
+		r := &OSArtifactReconciler{}
+		spec, err := r.exporterJobSpec(artifact, 0)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(spec.Template.Spec.RestartPolicy).To(Equal(corev1.RestartPolicyNever))
+		Expect(spec.Template.Spec.Containers).To(HaveLen(1))
+		container := spec.Template.Spec.Containers[0]
+		Expect(container.Image).To(Equal(DefaultS3Image))
+		Expect(container.EnvFrom[0].SecretRef.Name).To(Equal("minio"))
+		Expect(container.Args[0]).To(Equal(`aws configure set default.s3.addressing_style path
+aws configure set default.s3.multipart_threshold 67108864
+aws s3 cp --endpoint-url 'http://minio:9000' '/artifacts/test.iso' 's3://artifacts/kairos/default/test/test.iso'
+`))
+	})
+
+	It("keeps user defined job templates", func() {
+		artifact.Spec.Exporters[0].S3 = nil
+		artifact.Spec.Exporters[0].Template = &corev1.PodTemplateSpec{}
+		artifact.Spec.Exporters[0].Template.Spec.Containers = []corev1.Container{{Name: "upload", Image: "busybox"}}
+
+		r := &OSArtifactReconciler{}
+		spec, err := r.exporterJobSpec(artifact, 0)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(spec.Template.Spec.Containers[0].Name).To(Equal("upload"))
+	})
+
+	It("records the object URLs once", func() {
+		Expect(recordS3URLs(artifact, nil)).To(Succeed())
+		Expect(recordS3URLs(artifact, nil)).To(Succeed())
+
+		Expect(artifact.Status.Artifacts[0].URLs).To(Equal([]string{"http://minio:9000/artifacts/kairos/default/test/test.iso"}))
+		Expect(artifact.Status.Artifacts[1].URLs).To(BeEmpty())
+	})
+
+	It("only records the URLs of succeeded uploads", func() {
+		artifact.Status.Exports[0].Phase = osbuilder.ExportFailed
+		Expect(recordS3URLs(artifact, nil)).To(Succeed())
+		Expect(artifact.Status.Artifacts[0].URLs).To(BeEmpty())
+	})
+
+	It("renders the keys for the generation the job was created for", func() {
+		artifact.Spec.Exporters[0].S3.Path = "{{ .Generation }}/{{ .File }}"
+		artifact.Generation = 3
+		jobs := map[string]*batchv1.Job{"0": {ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{artifactGenerationAnnotation: "1"},
+		}}}
+
+		Expect(recordS3URLs(artifact, jobs)).To(Succeed())
+		Expect(artifact.Status.Artifacts[0].URLs).To(Equal([]string{"http://minio:9000/artifacts/kairos/1/test.iso"}))
+	})
+
+	It("builds AWS and virtual hosted URLs", func() {
+		exporter := &osbuilder.S3Exporter{Bucket: "artifacts", Region: "eu-west-1"}
+		Expect(exporter.ObjectURL("a b/test.iso")).To(Equal("https://artifacts.s3.eu-west-1.amazonaws.com/a%20b/test.iso"))
+
+		exporter.Endpoint = "https://storage.example.com"
+		Expect(exporter.ObjectURL("test.iso")).To(Equal("https://artifacts.storage.example.com/test.iso"))
+	})
+
+	It("quotes shell words", func() {
+		Expect(shellQuote("it's")).To(Equal(`'it'\''s'`))
+	})
+})
@@ -0,0 +1,59 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// applyScheduling copies the scheduling settings of builder to every field of
+// podSpec that is still unset.
+func applyScheduling(podSpec *corev1.PodSpec, builder *osbuilder.BuilderSpec) {
+	if builder == nil {
+		return
+	}
+	builder = builder.DeepCopy()
+
+	if podSpec.NodeSelector == nil {
+		podSpec.NodeSelector = builder.NodeSelector
+	}
+	if podSpec.Tolerations == nil {
+		podSpec.Tolerations = builder.Tolerations
+	}
+	if podSpec.Affinity == nil {
+		podSpec.Affinity = builder.Affinity
+	}
+	if podSpec.PriorityClassName == "" {
+		podSpec.PriorityClassName = builder.PriorityClassName
+	}
+	if podSpec.RuntimeClassName == nil {
+		podSpec.RuntimeClassName = builder.RuntimeClassName
+	}
+	if podSpec.TopologySpreadConstraints == nil {
+		podSpec.TopologySpreadConstraints = builder.TopologySpreadConstraints
+	}
+}
+
+// applyExporterScheduling applies the builder scheduling settings to an
+// exporter pod when spec.builder.applyToExporters is set.
+func applyExporterScheduling(podSpec *corev1.PodSpec, artifact *osbuilder.OSArtifact) {
+	if artifact.Spec.Builder == nil || !artifact.Spec.Builder.ApplyToExporters {
+		return
+	}
+	applyScheduling(podSpec, artifact.Spec.Builder)
+}
@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Scheduling", func() {
+	var artifact *osbuilder.OSArtifact
+
+	BeforeEach(func() {
+		artifact = &osbuilder.OSArtifact{
+			ObjectMeta: metav1.ObjectMeta{Name: "test"},
+			Spec: osbuilder.OSArtifactSpec{
+				ImageName: "quay.io/kairos/core-opensuse:latest",
+				Builder: &osbuilder.BuilderSpec{
+					NodeSelector:      map[string]string{"node-role.kubernetes.io/build": ""},
+					Tolerations:       []corev1.Toleration{{Key: "build", Operator: corev1.TolerationOpExists}},
+					PriorityClassName: "builds",
+					RuntimeClassName:  ptr("privileged"),
+				},
+			},
+		}
+	})
+
+	It("schedules the builder pod", func() {
+		r := &OSArtifactReconciler{ToolImage: "quay.io/kairos/auroraboot:latest"}
+		pod := r.newBuilderPod("test-artifacts", artifact)
+
+		Expect(pod.Spec.NodeSelector).To(HaveKey("node-role.kubernetes.io/build"))
+		Expect(pod.Spec.Tolerations).To(HaveLen(1))
+		Expect(pod.Spec.PriorityClassName).To(Equal("builds"))
+		Expect(*pod.Spec.RuntimeClassName).To(Equal("privileged"))
+	})
+
+	It("only applies to exporters when asked, keeping their own settings", func() {
+		podSpec := corev1.PodSpec{PriorityClassName: "exports"}
+		applyExporterScheduling(&podSpec, artifact)
+		Expect(podSpec.NodeSelector).To(BeNil())
+
+		artifact.Spec.Builder.ApplyToExporters = true
+		applyExporterScheduling(&podSpec, artifact)
+		Expect(podSpec.NodeSelector).To(HaveKey("node-role.kubernetes.io/build"))
+		Expect(podSpec.PriorityClassName).To(Equal("exports"))
+	})
+})
@@ -0,0 +1,358 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// serveIndex is the export index of the job copying the artifacts to
+	// the HTTP server, and of the cleanup job removing them.
+	serveIndex = "serve"
+
+	// servingName names the HTTP server statefulset and labels its pods.
+	servingName = "osbuilder-nginx"
+	// servingPodName is the only pod of the server. The copier Role only
+	// allows exec into it.
+	servingPodName = servingName + "-0"
+	// servingServiceName is the headless service governing the server
+	// statefulset, which gives its pod a stable DNS name.
+	servingServiceName = servingName + "-headless"
+	// servingPath is the directory the server serves files from.
+	servingPath = "/usr/share/nginx/html"
+	// copierServiceAccountName is the service account of the copier jobs,
+	// bound to ServeRole in ServeNamespace.
+	copierServiceAccountName = "osbuilder-copier"
+
+	// DefaultServingImage runs the HTTP server.
+	DefaultServingImage = "nginx"
+	// DefaultCopierImage provides kubectl, which copies the artifacts to
+	// the HTTP server.
+	DefaultCopierImage = "bitnami/kubectl:latest"
+)
+
+// copyArtifactsScript copies FILES from the artifacts volume to the directory
+// of the artifact on the server pod, replacing its previous content.
+const copyArtifactsScript = `kubectl exec -n "$SERVE_NAMESPACE" "$SERVER_POD" -- rm -rf "$SERVE_DIR"
+for file in $FILES; do
+  kubectl exec -n "$SERVE_NAMESPACE" "$SERVER_POD" -- mkdir -p "$(dirname "$SERVE_DIR/$file")"
+  kubectl cp "/artifacts/$file" "$SERVE_NAMESPACE/$SERVER_POD:$SERVE_DIR/$file"
+done
+`
+
+// removeArtifactsScript removes the directory of the artifact from the server
+// pod.
+const removeArtifactsScript = `kubectl exec -n "$SERVE_NAMESPACE" "$SERVER_POD" -- rm -rf "$SERVE_DIR"
+`
+
+// serves reports whether the operator serves artifacts over HTTP.
+func (r *OSArtifactReconciler) serves() bool {
+	return r.ServeNamespace != ""
+}
+
+// servedPath returns the path the files of the artifact are served under.
+func servedPath(artifact *osbuilder.OSArtifact) string {
+	return path.Join("/", artifact.Namespace, artifact.Name)
+}
+
+// servedURL returns the download URL of a file of the artifact.
+func (r *OSArtifactReconciler) servedURL(artifact *osbuilder.OSArtifact, file string) string {
+	return strings.TrimSuffix(r.ServeURL, "/") + path.Join(servedPath(artifact), file)
+}
+
+// copierJobSpec returns a job running script with kubectl against the server
+// pod.
+func (r *OSArtifactReconciler) copierJobSpec(artifact *osbuilder.OSArtifact, name, script string, env ...corev1.EnvVar) batchv1.JobSpec {
+	copierImage := r.CopierImage
+	if copierImage == "" {
+		copierImage = DefaultCopierImage
+	}
+
+	return batchv1.JobSpec{
+		Template: corev1.PodTemplateSpec{
+			Spec: corev1.PodSpec{
+				RestartPolicy:      corev1.RestartPolicyNever,
+				ServiceAccountName: copierServiceAccountName,
+				Containers: []corev1.Container{
+					{
+						ImagePullPolicy: corev1.PullAlways,
+						Name:            name,
+						Image:           copierImage,
+						Command:         []string{"/bin/bash", "-cxe"},
+						Args:            []string{script},
+						Env: append([]corev1.EnvVar{
+							{Name: "SERVE_NAMESPACE", Value: r.ServeNamespace},
+							{Name: "SERVER_POD", Value: servingPodName},
+							{Name: "SERVE_DIR", Value: servingPath + servedPath(artifact)},
+						}, env...),
+						VolumeMounts: []corev1.VolumeMount{
+							{
+								Name:      "artifacts",
+								MountPath: "/artifacts",
+								ReadOnly:  true,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// serveJobSpec returns the job copying the built files to the server.
+func (r *OSArtifactReconciler) serveJobSpec(artifact *osbuilder.OSArtifact) batchv1.JobSpec {
+	var files []string
+	for _, file := range artifact.Status.Artifacts {
+		files = append(files, file.Name)
+	}
+
+	return r.copierJobSpec(artifact, "copy-artifacts", copyArtifactsScript,
+		corev1.EnvVar{Name: "FILES", Value: strings.Join(files, " ")})
+}
+
+// unserveJobSpec returns the job removing the files of the artifact from the
+// server.
+func (r *OSArtifactReconciler) unserveJobSpec(artifact *osbuilder.OSArtifact) *batchv1.JobSpec {
+	spec := r.copierJobSpec(artifact, "remove-artifacts", removeArtifactsScript)
+	return &spec
+}
+
+// recordServedURLs adds the download URLs of the served files to
+// status.artifacts.
+func (r *OSArtifactReconciler) recordServedURLs(artifact *osbuilder.OSArtifact) {
+	if !artifact.Spec.Serve || !r.serves() {
+		return
+	}
+
+	for i := range artifact.Status.Artifacts {
+		file := &artifact.Status.Artifacts[i]
+		url := r.servedURL(artifact, file.Name)
+		if !containsString(file.URLs, url) {
+			file.URLs = append(file.URLs, url)
+		}
+	}
+}
+
+// wasServed reports whether status.artifacts lists a download URL of the
+// server.
+func (r *OSArtifactReconciler) wasServed(artifact *osbuilder.OSArtifact) bool {
+	for _, file := range artifact.Status.Artifacts {
+		if containsString(file.URLs, r.servedURL(artifact, file.Name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// prepareServing makes sure the server runs with ServingImage and that the
+// copier jobs of the artifact namespace may exec into its pods.
+func (r *OSArtifactReconciler) prepareServing(ctx context.Context, artifact *osbuilder.OSArtifact) error {
+	if err := r.ensureServer(ctx); err != nil {
+		return err
+	}
+
+	serviceAccount := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      copierServiceAccountName,
+			Namespace: artifact.Namespace,
+		},
+	}
+	if err := r.Create(ctx, serviceAccount); err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	roleBinding := &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      copierRoleBindingName(artifact.Namespace),
+			Namespace: r.ServeNamespace,
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "Role",
+			Name:     r.ServeRole,
+		},
+		Subjects: []rbacv1.Subject{
+			{
+				Kind:      rbacv1.ServiceAccountKind,
+				Name:      copierServiceAccountName,
+				Namespace: artifact.Namespace,
+			},
+		},
+	}
+	if err := r.Create(ctx, roleBinding); err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	return nil
+}
+
+// releaseServing removes the service account and the role binding of the
+// copier jobs of the artifact namespace, once no other artifact there is
+// served.
+func (r *OSArtifactReconciler) releaseServing(ctx context.Context, artifact *osbuilder.OSArtifact) error {
+	if !r.serves() || !artifact.Spec.Serve {
+		return nil
+	}
+
+	var artifacts osbuilder.OSArtifactList
+	if err := r.List(ctx, &artifacts, client.InNamespace(artifact.Namespace)); err != nil {
+		return err
+	}
+	for _, other := range artifacts.Items {
+		if other.UID != artifact.UID && other.Spec.Serve {
+			return nil
+		}
+	}
+
+	roleBinding := &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      copierRoleBindingName(artifact.Namespace),
+			Namespace: r.ServeNamespace,
+		},
+	}
+	if err := r.Delete(ctx, roleBinding); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	serviceAccount := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      copierServiceAccountName,
+			Namespace: artifact.Namespace,
+		},
+	}
+	if err := r.Delete(ctx, serviceAccount); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
+
+// copierRoleBindingName names the role binding of the copier jobs of
+// namespace.
+func copierRoleBindingName(namespace string) string {
+	return fmt.Sprintf("%s-%s", copierServiceAccountName, namespace)
+}
+
+// ensureServer creates the server statefulset and its headless service, or
+// updates the image of the server.
+func (r *OSArtifactReconciler) ensureServer(ctx context.Context) error {
+	servingImage := r.ServingImage
+	if servingImage == "" {
+		servingImage = DefaultServingImage
+	}
+
+	if err := r.Create(ctx, newServerService(r.ServeNamespace)); err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	var server appsv1.StatefulSet
+	err := r.Get(ctx, types.NamespacedName{Namespace: r.ServeNamespace, Name: servingName}, &server)
+	if apierrors.IsNotFound(err) {
+		return r.Create(ctx, newServer(r.ServeNamespace, servingImage, r.ServeVolume))
+	}
+	if err != nil {
+		return err
+	}
+
+	containers := server.Spec.Template.Spec.Containers
+	if len(containers) == 0 || containers[0].Image == servingImage {
+		return nil
+	}
+	patch := server.DeepCopy()
+	patch.Spec.Template.Spec.Containers[0].Image = servingImage
+	return r.Update(ctx, patch)
+}
+
+// newServerService returns the headless service of the server statefulset.
+func newServerService(namespace string) *corev1.Service {
+	labels := map[string]string{"app.kubernetes.io/name": servingName}
+
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      servingServiceName,
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: corev1.ClusterIPNone,
+			Selector:  labels,
+			Ports:     []corev1.ServicePort{{Name: "http", Port: 80}},
+		},
+	}
+}
+
+// newServer returns the server statefulset. Its single replica keeps the
+// name servingPodName across restarts.
+func newServer(namespace, image, volume string) *appsv1.StatefulSet {
+	labels := map[string]string{"app.kubernetes.io/name": servingName}
+
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      servingName,
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    ptr(int32(1)),
+			ServiceName: servingServiceName,
+			Selector:    &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					TerminationGracePeriodSeconds: ptr(int64(10)),
+					Containers: []corev1.Container{
+						{
+							Name:  "nginx",
+							Image: image,
+							Ports: []corev1.ContainerPort{{ContainerPort: 80}},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "public",
+									MountPath: servingPath,
+								},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "public",
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+									ClaimName: volume,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
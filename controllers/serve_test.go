@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"context"
+
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("Serve", func() {
+	var artifact *osbuilder.OSArtifact
+	var r *OSArtifactReconciler
+
+	BeforeEach(func() {
+		artifact = &osbuilder.OSArtifact{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default", UID: "uid"},
+			Spec:       osbuilder.OSArtifactSpec{Serve: true},
+			Status: osbuilder.OSArtifactStatus{
+				Artifacts: []osbuilder.ArtifactFile{
+					{Name: "test.iso", Type: osbuilder.ArtifactISO},
+					{Name: "netboot/test.ipxe", Type: osbuilder.ArtifactNetbootScript},
+				},
+			},
+		}
+
+		r = &OSArtifactReconciler{
+			Client:         newFakeClient(),
+			ServingImage:   "nginx:1.25",
+			ServeNamespace: "osbuilder",
+			ServeVolume:    "nginx-public",
+			ServeRole:      "artifact-copier",
+			ServeURL:       "http://osbuilder-nginx.osbuilder.svc/",
+		}
+	})
+
+	It("copies the built files with the copier image", func() {
+		spec := r.serveJobSpec(artifact)
+
+		Expect(spec.Template.Spec.ServiceAccountName).To(Equal(copierServiceAccountName))
+		container := spec.Template.Spec.Containers[0]
+		Expect(container.Image).To(Equal(DefaultCopierImage))
+		Expect(container.Env).To(ContainElements(
+			corev1.EnvVar{Name: "SERVE_NAMESPACE", Value: "osbuilder"},
+			corev1.EnvVar{Name: "SERVER_POD", Value: "osbuilder-nginx-0"},
+			corev1.EnvVar{Name: "SERVE_DIR", Value: "/usr/share/nginx/html/default/test"},
+			corev1.EnvVar{Name: "FILES", Value: "test.iso netboot/test.ipxe"},
+		))
+	})
+
+	It("runs the server and lets the copier exec into it", func() {
+		Expect(r.prepareServing(context.TODO(), artifact)).To(Succeed())
+
+		var server appsv1.StatefulSet
+		Expect(r.Get(context.TODO(), client.ObjectKey{Namespace: "osbuilder", Name: servingName}, &server)).To(Succeed())
+		Expect(server.Spec.Template.Spec.Containers[0].Image).To(Equal("nginx:1.25"))
+		Expect(server.Spec.Template.Spec.Volumes[0].PersistentVolumeClaim.ClaimName).To(Equal("nginx-public"))
+		var service corev1.Service
+		Expect(r.Get(context.TODO(), client.ObjectKey{Namespace: "osbuilder", Name: server.Spec.ServiceName}, &service)).To(Succeed())
+		Expect(service.Spec.ClusterIP).To(Equal(corev1.ClusterIPNone))
+
+		var roleBinding rbacv1.RoleBinding
+		Expect(r.Get(context.TODO(), client.ObjectKey{Namespace: "osbuilder", Name: "osbuilder-copier-default"}, &roleBinding)).To(Succeed())
+		Expect(roleBinding.RoleRef.Name).To(Equal("artifact-copier"))
+		Expect(roleBinding.Subjects[0].Namespace).To(Equal("default"))
+		Expect(r.Get(context.TODO(), client.ObjectKey{Namespace: "default", Name: copierServiceAccountName}, &corev1.ServiceAccount{})).To(Succeed())
+
+		r.ServingImage = "nginx:1.27"
+		Expect(r.prepareServing(context.TODO(), artifact)).To(Succeed())
+		Expect(r.Get(context.TODO(), client.ObjectKey{Namespace: "osbuilder", Name: servingName}, &server)).To(Succeed())
+		Expect(server.Spec.Template.Spec.Containers[0].Image).To(Equal("nginx:1.27"))
+	})
+
+	It("unbinds the copier once the last served artifact of the namespace is gone", func() {
+		other := &osbuilder.OSArtifact{
+			ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default", UID: "other-uid"},
+			Spec:       osbuilder.OSArtifactSpec{Serve: true},
+		}
+		Expect(r.Create(context.TODO(), artifact.DeepCopy())).To(Succeed())
+		Expect(r.Create(context.TODO(), other)).To(Succeed())
+		Expect(r.prepareServing(context.TODO(), artifact)).To(Succeed())
+		roleBindingKey := client.ObjectKey{Namespace: "osbuilder", Name: "osbuilder-copier-default"}
+		serviceAccountKey := client.ObjectKey{Namespace: "default", Name: copierServiceAccountName}
+
+		Expect(r.releaseServing(context.TODO(), artifact)).To(Succeed())
+		Expect(r.Get(context.TODO(), roleBindingKey, &rbacv1.RoleBinding{})).To(Succeed())
+
+		Expect(r.Delete(context.TODO(), other)).To(Succeed())
+		Expect(r.releaseServing(context.TODO(), artifact)).To(Succeed())
+		Expect(apierrors.IsNotFound(r.Get(context.TODO(), roleBindingKey, &rbacv1.RoleBinding{}))).To(BeTrue())
+		Expect(apierrors.IsNotFound(r.Get(context.TODO(), serviceAccountKey, &corev1.ServiceAccount{}))).To(BeTrue())
+	})
+
+	It("records the download URLs", func() {
+		r.recordServedURLs(artifact)
+
+		Expect(artifact.Status.Artifacts[0].URLs).To(Equal([]string{"http://osbuilder-nginx.osbuilder.svc/default/test/test.iso"}))
+		Expect(artifact.Status.Artifacts[1].URLs).To(Equal([]string{"http://osbuilder-nginx.osbuilder.svc/default/test/netboot/test.ipxe"}))
+	})
+
+	It("removes the served files before the artifact is deleted", func() {
+		Expect(r.Create(context.TODO(), &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "test-export-serve",
+				Namespace:   "default",
+				Labels:      map[string]string{artifactLabel: "test"},
+				Annotations: map[string]string{artifactExporterIndexAnnotation: serveIndex},
+			},
+		})).To(Succeed())
+
+		cleaned, err := r.runCleanup(context.TODO(), artifact)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cleaned).To(BeFalse())
+
+		var job batchv1.Job
+		Expect(r.Get(context.TODO(), client.ObjectKey{Namespace: "default", Name: "test-cleanup-serve"}, &job)).To(Succeed())
+		Expect(job.Spec.Template.Spec.Containers[0].Name).To(Equal("remove-artifacts"))
+	})
+})
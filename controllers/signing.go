@@ -0,0 +1,266 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	signArtifactsContainerName   = "sign-artifacts"
+	signImageContainerName       = "sign-image"
+	signOCIArtifactContainerName = "sign-oci-artifact"
+
+	// DefaultCosignImage provides cosign v2 and a shell.
+	DefaultCosignImage = "gcr.io/projectsigstore/cosign:v2.4.1-dev"
+	// DefaultGPGImage provides gpg and a shell.
+	DefaultGPGImage = "buildpack-deps:bookworm-curl"
+
+	// signingVolume holds the private key and its password.
+	signingVolume = "signing-key"
+	// pushedVolume passes the digest references of the pushed images to the
+	// containers signing them.
+	pushedVolume = "pushed"
+)
+
+// signatureSuffixes are appended to the name of a file to name its detached
+// signature.
+var signatureSuffixes = map[osbuilder.SigningMethod]string{
+	osbuilder.SigningCosign: ".sig",
+	osbuilder.SigningGPG:    ".asc",
+}
+
+// signFileCommands sign "$f" into "$f<suffix>", after the setup commands ran.
+var signFileCommands = map[osbuilder.SigningMethod]struct{ setup, sign string }{
+	osbuilder.SigningCosign: {
+		sign: `cosign sign-blob --yes --tlog-upload=false --key /signing/key --output-signature "$f.sig" "$f"`,
+	},
+	osbuilder.SigningGPG: {
+		setup: `command -v gpg >/dev/null || { echo "gpg is missing from the signing image" >&2; exit 1; }
+export GNUPGHOME=/tmp/gnupg
+mkdir -p -m 700 "$GNUPGHOME"
+gpg --batch --import /signing/key
+if [ -f /signing/password ]; then
+  set -- --passphrase-file /signing/password
+else
+  set -- --passphrase ''
+fi`,
+		sign: `gpg --batch --yes --pinentry-mode loopback "$@" --armor --detach-sign --output "$f.asc" "$f"`,
+	},
+}
+
+// signArtifactsScript replaces the signatures on the artifacts volume with
+// a detached signature of every other file.
+func signArtifactsScript(method osbuilder.SigningMethod) string {
+	commands := signFileCommands[method]
+	return fmt.Sprintf(`cd /artifacts
+find . -type f \( -name '*.sig' -o -name '*.asc' \) -exec rm -f {} +
+%s
+find . -type f | sed 's|^\./||' | sort | while read -r f; do
+  %s
+done
+`, commands.setup, commands.sign)
+}
+
+// signImageScript signs the image pushed by a previous container by digest.
+const signImageScript = `ref=$(cat /pushed/ref)
+cosign sign --yes --tlog-upload=false --key /signing/key $REGISTRY_FLAGS "$ref"
+`
+
+// signingEnv passes the password of the cosign key. cosign prompts for it
+// when COSIGN_PASSWORD is not set, even if the key has none.
+func signingEnv(signing *osbuilder.SigningSpec) []corev1.EnvVar {
+	if signing.Method != osbuilder.SigningCosign {
+		return nil
+	}
+	if signing.PasswordKey == "" {
+		return []corev1.EnvVar{{Name: "COSIGN_PASSWORD", Value: ""}}
+	}
+	return []corev1.EnvVar{{
+		Name: "COSIGN_PASSWORD",
+		ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: signing.KeyRef.Name},
+			Key:                  signing.PasswordKey,
+		}},
+	}}
+}
+
+func signArtifactsContainer(containerImage string, signing *osbuilder.SigningSpec) corev1.Container {
+	return corev1.Container{
+		ImagePullPolicy: corev1.PullAlways,
+		Name:            signArtifactsContainerName,
+		Image:           containerImage,
+		Command:         []string{"/bin/sh", "-cxe"},
+		Args:            []string{signArtifactsScript(signing.Method)},
+		Env:             signingEnv(signing),
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      "artifacts",
+				MountPath: "/artifacts",
+			},
+			{
+				Name:      signingVolume,
+				MountPath: "/signing",
+				ReadOnly:  true,
+			},
+		},
+	}
+}
+
+// signImageContainer signs the image the container named after prefix
+// pushed to push, with the registry settings of that push.
+func signImageContainer(name, containerImage, prefix string, push *osbuilder.PushSpec, signing *osbuilder.SigningSpec) corev1.Container {
+	var registryFlags []string
+	env := signingEnv(signing)
+	volumeMounts := []corev1.VolumeMount{
+		{
+			Name:      signingVolume,
+			MountPath: "/signing",
+			ReadOnly:  true,
+		},
+		pushedMount(prefix),
+	}
+	if push.Insecure {
+		registryFlags = append(registryFlags, "--allow-insecure-registry", "--allow-http-registry")
+	}
+	if push.CredentialsSecretRef != nil {
+		env = append(env, corev1.EnvVar{Name: "DOCKER_CONFIG", Value: "/" + prefix + "/docker"})
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      prefix + "-credentials",
+			MountPath: "/" + prefix + "/docker",
+			ReadOnly:  true,
+		})
+	}
+	if push.CARef != nil {
+		env = append(env, corev1.EnvVar{Name: "SSL_CERT_DIR", Value: "/" + prefix + "/ca:/etc/ssl/certs"})
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      prefix + "-ca",
+			MountPath: "/" + prefix + "/ca",
+			ReadOnly:  true,
+		})
+	}
+	env = append(env, corev1.EnvVar{Name: "REGISTRY_FLAGS", Value: strings.Join(registryFlags, " ")})
+
+	return corev1.Container{
+		ImagePullPolicy: corev1.PullAlways,
+		Name:            name,
+		Image:           containerImage,
+		Command:         []string{"/bin/sh", "-cxe"},
+		Args:            []string{signImageScript},
+		Env:             env,
+		VolumeMounts:    volumeMounts,
+	}
+}
+
+// pushedMount shares /pushed/ref between the container pushing an image and
+// the one signing it.
+func pushedMount(prefix string) corev1.VolumeMount {
+	return corev1.VolumeMount{
+		Name:      pushedVolume,
+		MountPath: "/pushed",
+		SubPath:   prefix,
+	}
+}
+
+// signingVolumes returns the Secret volume with the signing key and, when
+// images are signed, the volume passing their references.
+func signingVolumes(signing *osbuilder.SigningSpec, signsImages bool) []corev1.Volume {
+	items := []corev1.KeyToPath{{Key: signing.KeyRef.Key, Path: "key"}}
+	if signing.PasswordKey != "" {
+		items = append(items, corev1.KeyToPath{Key: signing.PasswordKey, Path: "password"})
+	}
+
+	volumes := []corev1.Volume{{
+		Name: signingVolume,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: signing.KeyRef.Name,
+				Items:      items,
+			},
+		},
+	}}
+	if signsImages {
+		volumes = append(volumes, corev1.Volume{
+			Name:         pushedVolume,
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		})
+	}
+
+	return volumes
+}
+
+// signsImages reports whether the pushed image and OCI artifact are signed.
+func signsImages(artifact *osbuilder.OSArtifact) bool {
+	signing := artifact.Spec.Signing
+	return signing != nil && signing.Method == osbuilder.SigningCosign &&
+		(artifact.Spec.Push != nil || artifact.Spec.OCIArtifact != nil)
+}
+
+// signingImage returns the image the signing containers run.
+func (r *OSArtifactReconciler) signingImage(method osbuilder.SigningMethod) string {
+	if method == osbuilder.SigningGPG {
+		if r.GPGImage != "" {
+			return r.GPGImage
+		}
+		return DefaultGPGImage
+	}
+	if r.CosignImage != "" {
+		return r.CosignImage
+	}
+	return DefaultCosignImage
+}
+
+// cosignSignature returns the image cosign stores the signature of a
+// manifest in. This is the tag scheme of cosign v2, which it keeps as long as
+// neither COSIGN_REPOSITORY nor the OCI 1.1 referrers mode is set; cosign
+// images storing signatures as referrers get a wrong status.push.signature.
+func cosignSignature(push *osbuilder.PushStatus) string {
+	return fmt.Sprintf("%s:%s.sig", push.Image, strings.Replace(push.Digest, ":", "-", 1))
+}
+
+// recordSignatures lists the signatures the builder pod wrote in status.
+func recordSignatures(artifact *osbuilder.OSArtifact) {
+	signing := artifact.Spec.Signing
+	if signing == nil {
+		return
+	}
+
+	suffix := signatureSuffixes[signing.Method]
+	files := map[string]bool{}
+	for _, file := range artifact.Status.Artifacts {
+		files[file.Name] = true
+	}
+	for i := range artifact.Status.Artifacts {
+		file := &artifact.Status.Artifacts[i]
+		if file.Type != osbuilder.ArtifactSignature && files[file.Name+suffix] {
+			file.Signature = file.Name + suffix
+		}
+	}
+
+	if signsImages(artifact) {
+		if push := artifact.Status.Push; push != nil {
+			push.Signature = cosignSignature(push)
+		}
+		if push := artifact.Status.OCIArtifact; push != nil {
+			push.Signature = cosignSignature(push)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Signing", func() {
+	var artifact *osbuilder.OSArtifact
+	var r *OSArtifactReconciler
+
+	BeforeEach(func() {
+		r = &OSArtifactReconciler{ToolImage: "quay.io/kairos/auroraboot:latest"}
+		artifact = &osbuilder.OSArtifact{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+			Spec: osbuilder.OSArtifactSpec{
+				ImageName: "quay.io/kairos/core-opensuse:latest",
+				ISO:       true,
+				Push: &osbuilder.PushSpec{
+					Destination:          "registry.example.com/kairos/custom:v1",
+					CredentialsSecretRef: &corev1.LocalObjectReference{Name: "registry"},
+				},
+				OCIArtifact: &osbuilder.OCIArtifactSpec{
+					PushSpec: osbuilder.PushSpec{Destination: "localhost:5000/kairos/iso:v1", Insecure: true},
+				},
+				Signing: &osbuilder.SigningSpec{
+					Method:      osbuilder.SigningCosign,
+					KeyRef:      osbuilder.SecretKeySelector{Name: "signing", Key: "cosign.key"},
+					PasswordKey: "cosign.password",
+				},
+			},
+		}
+	})
+
+	containers := func(pod *corev1.Pod) map[string]corev1.Container {
+		byName := map[string]corev1.Container{}
+		for _, c := range pod.Spec.InitContainers {
+			byName[c.Name] = c
+		}
+		return byName
+	}
+
+	It("signs the files after the checksums and the images after pushing them", func() {
+		pod := r.newBuilderPod("test-artifacts", artifact)
+
+		var names []string
+		for _, c := range pod.Spec.InitContainers {
+			names = append(names, c.Name)
+		}
+		Expect(names[len(names)-6:]).To(Equal([]string{
+			writeChecksumsContainerName,
+			signArtifactsContainerName,
+			pushImageContainerName,
+			signImageContainerName,
+			ociArtifactContainerName,
+			signOCIArtifactContainerName,
+		}))
+
+		byName := containers(pod)
+		sign := byName[signArtifactsContainerName]
+		Expect(sign.Image).To(Equal(DefaultCosignImage))
+		Expect(sign.Args[0]).To(ContainSubstring("cosign sign-blob"))
+		Expect(sign.Env).To(ConsistOf(HaveField("ValueFrom.SecretKeyRef.Key", "cosign.password")))
+
+		Expect(byName[pushImageContainerName].VolumeMounts).To(ContainElement(pushedMount("push")))
+		Expect(byName[signImageContainerName].VolumeMounts).To(ContainElement(pushedMount("push")))
+		Expect(byName[signImageContainerName].Env).To(ContainElement(corev1.EnvVar{Name: "DOCKER_CONFIG", Value: "/push/docker"}))
+		Expect(byName[signOCIArtifactContainerName].VolumeMounts).To(ContainElement(pushedMount("oci")))
+		Expect(byName[signOCIArtifactContainerName].Env).To(ContainElement(corev1.EnvVar{
+			Name: "REGISTRY_FLAGS", Value: "--allow-insecure-registry --allow-http-registry",
+		}))
+
+		Expect(pod.Spec.Volumes).To(ContainElement(And(
+			HaveField("Name", signingVolume),
+			HaveField("Secret.Items", ConsistOf(
+				corev1.KeyToPath{Key: "cosign.key", Path: "key"},
+				corev1.KeyToPath{Key: "cosign.password", Path: "password"},
+			)),
+		)))
+	})
+
+	It("only signs the files with GPG", func() {
+		artifact.Spec.Signing = &osbuilder.SigningSpec{
+			Method: osbuilder.SigningGPG,
+			KeyRef: osbuilder.SecretKeySelector{Name: "signing", Key: "gpg.key"},
+		}
+		pod := r.newBuilderPod("test-artifacts", artifact)
+
+		byName := containers(pod)
+		Expect(byName).To(HaveKey(signArtifactsContainerName))
+		Expect(byName).ToNot(HaveKey(signImageContainerName))
+		Expect(byName).ToNot(HaveKey(signOCIArtifactContainerName))
+		Expect(byName[signArtifactsContainerName].Image).To(Equal(DefaultGPGImage))
+		Expect(byName[signArtifactsContainerName].Args[0]).To(ContainSubstring("--detach-sign"))
+		Expect(byName[pushImageContainerName].VolumeMounts).ToNot(ContainElement(HaveField("Name", pushedVolume)))
+		Expect(pod.Spec.Volumes).ToNot(ContainElement(HaveField("Name", pushedVolume)))
+	})
+
+	It("lists the signatures in status", func() {
+		artifact.Status.Artifacts = []osbuilder.ArtifactFile{
+			{Name: "test.iso", Type: osbuilder.ArtifactISO},
+			{Name: "test.iso.sig", Type: osbuilder.ArtifactSignature},
+			{Name: "test.tar", Type: osbuilder.ArtifactContainerImage},
+		}
+		artifact.Status.Push = &osbuilder.PushStatus{Image: "registry.example.com/kairos/custom", Digest: "sha256:abc"}
+
+		recordSignatures(artifact)
+		Expect(artifact.Status.Artifacts[0].Signature).To(Equal("test.iso.sig"))
+		Expect(artifact.Status.Artifacts[1].Signature).To(BeEmpty())
+		Expect(artifact.Status.Artifacts[2].Signature).To(BeEmpty())
+		Expect(artifact.Status.Push.Signature).To(Equal("registry.example.com/kairos/custom:sha256-abc.sig"))
+	})
+})
@@ -0,0 +1,95 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const describeSourceContainerName = "describe-source"
+
+// describeSourceScript resolves the digest of the source image and reads the
+// Kairos release of the rootfs, then writes them to the termination log,
+// where checkBuild collects them. Both are informative, neither fails the
+// build.
+const describeSourceScript = `digest=""
+if [ -n "$IMAGE" ]; then
+  digest=$(crane digest "$IMAGE") || digest=""
+fi
+` + readKairosReleaseScript + `printf '{"image":"%s","digest":"%s","kairosVersion":"%s","kairosFlavor":"%s"}' \
+  "$IMAGE" "$digest" "${KAIROS_VERSION:-}" "${KAIROS_FLAVOR:-}" > /dev/termination-log
+`
+
+// sourceImage returns the reference of the image the rootfs is unpacked from,
+// or an empty string if it is built from a Dockerfile.
+func sourceImage(artifact *osbuilder.OSArtifact) string {
+	switch {
+	case artifact.Spec.BaseImageDockerfile != nil:
+		return ""
+	case artifact.Spec.BaseImageName != "":
+		return artifact.Spec.BaseImageName
+	default:
+		return artifact.Spec.ImageName
+	}
+}
+
+// describeSourceContainer runs crane, from containerImage, once the rootfs is
+// complete.
+func describeSourceContainer(containerImage string, artifact *osbuilder.OSArtifact) corev1.Container {
+	return corev1.Container{
+		ImagePullPolicy: corev1.PullAlways,
+		Name:            describeSourceContainerName,
+		Image:           containerImage,
+		Command:         []string{"/busybox/sh", "-cxe"},
+		Args:            []string{describeSourceScript},
+		Env: []corev1.EnvVar{
+			{Name: "IMAGE", Value: sourceImage(artifact)},
+		},
+		TerminationMessagePolicy: corev1.TerminationMessageReadFile,
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      "rootfs",
+				MountPath: "/rootfs",
+				ReadOnly:  true,
+			},
+		},
+	}
+}
+
+// describedSource reads the source described by a succeeded builder pod.
+func describedSource(pod *corev1.Pod) (*osbuilder.SourceStatus, error) {
+	for _, status := range pod.Status.InitContainerStatuses {
+		if status.Name != describeSourceContainerName {
+			continue
+		}
+		if status.State.Terminated == nil {
+			return nil, fmt.Errorf("container %s has not terminated", status.Name)
+		}
+
+		var source osbuilder.SourceStatus
+		if err := json.Unmarshal([]byte(status.State.Terminated.Message), &source); err != nil {
+			return nil, fmt.Errorf("parsing the source described by %s: %w", status.Name, err)
+		}
+		return &source, nil
+	}
+
+	return nil, fmt.Errorf("builder pod %s has no %s container", pod.Name, describeSourceContainerName)
+}
@@ -0,0 +1,292 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func setCondition(artifact *osbuilder.OSArtifact, condType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&artifact.Status.Conditions, metav1.Condition{
+		Type:               condType,
+		Status:             status,
+		ObservedGeneration: artifact.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// markQueued records that the artifact waits for a build slot.
+func markQueued(artifact *osbuilder.OSArtifact, position int32) {
+	message := fmt.Sprintf("Waiting for a build slot, position %d in the queue", position)
+	artifact.Status.Phase = osbuilder.Queued
+	artifact.Status.QueuePosition = position
+	artifact.Status.Reason = osbuilder.ReasonQueued
+	artifact.Status.Message = message
+
+	setCondition(artifact, osbuilder.ConditionReady, metav1.ConditionFalse, osbuilder.ReasonQueued, message)
+}
+
+// markBuilding resets the status for a fresh build of the current generation.
+func markBuilding(artifact *osbuilder.OSArtifact) {
+	now := metav1.Now()
+	artifact.Status.Phase = osbuilder.Building
+	artifact.Status.QueuePosition = 0
+	artifact.Status.ObservedGeneration = artifact.Generation
+	artifact.Status.BuildHash = artifact.Spec.BuildHash()
+	artifact.Status.StartTime = &now
+	artifact.Status.CompletionTime = nil
+	artifact.Status.Reason = osbuilder.ReasonBuilding
+	artifact.Status.Message = ""
+	artifact.Status.Attempts = nil
+	artifact.Status.Exports = nil
+	artifact.Status.Source = nil
+	artifact.Status.Push = nil
+	artifact.Status.OCIArtifact = nil
+	artifact.Status.Artifacts = nil
+
+	setCondition(artifact, osbuilder.ConditionSourceResolved, metav1.ConditionUnknown, osbuilder.ReasonResolving, "Unpacking source images into the rootfs")
+	setCondition(artifact, osbuilder.ConditionBuilt, metav1.ConditionFalse, osbuilder.ReasonBuilding, "Builder pod has been created")
+	setCondition(artifact, osbuilder.ConditionExported, metav1.ConditionUnknown, osbuilder.ReasonBuilding, "Waiting for the build to finish")
+	setCondition(artifact, osbuilder.ConditionReady, metav1.ConditionFalse, osbuilder.ReasonBuilding, "Waiting for the build to finish")
+}
+
+// markRebuilding resets the status after the spec changed, so that a new build
+// is started for the current generation.
+func markRebuilding(artifact *osbuilder.OSArtifact) {
+	message := fmt.Sprintf("Spec changed, rebuilding generation %d", artifact.Generation)
+	artifact.Status.Phase = osbuilder.Pending
+	artifact.Status.ObservedGeneration = artifact.Generation
+	artifact.Status.StartTime = nil
+	artifact.Status.CompletionTime = nil
+	artifact.Status.Reason = osbuilder.ReasonSpecChanged
+	artifact.Status.Message = message
+	artifact.Status.Attempts = nil
+	artifact.Status.Artifacts = nil
+
+	setCondition(artifact, osbuilder.ConditionSourceResolved, metav1.ConditionUnknown, osbuilder.ReasonSpecChanged, message)
+	setCondition(artifact, osbuilder.ConditionBuilt, metav1.ConditionFalse, osbuilder.ReasonSpecChanged, message)
+	setCondition(artifact, osbuilder.ConditionExported, metav1.ConditionFalse, osbuilder.ReasonSpecChanged, message)
+	setCondition(artifact, osbuilder.ConditionReady, metav1.ConditionFalse, osbuilder.ReasonSpecChanged, message)
+}
+
+// markRetrying records that the current attempt failed with reason and that
+// another one is started after delay.
+func markRetrying(artifact *osbuilder.OSArtifact, reason, message string, delay time.Duration) {
+	message = fmt.Sprintf("Attempt %d of %d failed (%s), retrying in %s: %s",
+		currentAttempt(artifact).Attempt, retryPolicy(artifact).MaxAttempts, reason, delay.Round(time.Second), message)
+	artifact.Status.Reason = osbuilder.ReasonRetrying
+	artifact.Status.Message = message
+
+	setCondition(artifact, osbuilder.ConditionSourceResolved, metav1.ConditionUnknown, osbuilder.ReasonRetrying, message)
+	setCondition(artifact, osbuilder.ConditionBuilt, metav1.ConditionFalse, osbuilder.ReasonRetrying, message)
+	setCondition(artifact, osbuilder.ConditionReady, metav1.ConditionFalse, osbuilder.ReasonRetrying, message)
+}
+
+// markAttemptStarted records that the builder pod of a retry was created.
+func markAttemptStarted(artifact *osbuilder.OSArtifact) {
+	message := fmt.Sprintf("Attempt %d of %d", currentAttempt(artifact).Attempt, retryPolicy(artifact).MaxAttempts)
+	artifact.Status.Reason = osbuilder.ReasonBuilding
+	artifact.Status.Message = message
+
+	setCondition(artifact, osbuilder.ConditionSourceResolved, metav1.ConditionUnknown, osbuilder.ReasonResolving, "Unpacking source images into the rootfs")
+	setCondition(artifact, osbuilder.ConditionBuilt, metav1.ConditionFalse, osbuilder.ReasonBuilding, "Builder pod has been created")
+	setCondition(artifact, osbuilder.ConditionReady, metav1.ConditionFalse, osbuilder.ReasonBuilding, message)
+}
+
+// markSuspended records that the build or the exporters of the artifact were
+// stopped because spec.suspend is set.
+func markSuspended(artifact *osbuilder.OSArtifact) {
+	stage, condType, status := "build", osbuilder.ConditionBuilt, metav1.ConditionFalse
+	if artifact.Status.Phase == osbuilder.Exporting {
+		stage, condType, status = "export", osbuilder.ConditionExported, metav1.ConditionUnknown
+	}
+	message := fmt.Sprintf("Suspended during the %s, which starts over once spec.suspend is unset", stage)
+	artifact.Status.Phase = osbuilder.Suspended
+	artifact.Status.QueuePosition = 0
+	artifact.Status.Reason = osbuilder.ReasonSuspended
+	artifact.Status.Message = message
+
+	setCondition(artifact, condType, status, osbuilder.ReasonSuspended, message)
+	setCondition(artifact, osbuilder.ConditionReady, metav1.ConditionFalse, osbuilder.ReasonSuspended, message)
+}
+
+// markResumed moves a suspended artifact back to the start of the stage it
+// was suspended in. Artifacts that were built only run their exporters again.
+func markResumed(artifact *osbuilder.OSArtifact) {
+	if meta.IsStatusConditionTrue(artifact.Status.Conditions, osbuilder.ConditionBuilt) {
+		markExporting(artifact)
+		return
+	}
+
+	message := "Resumed, waiting for the build to start"
+	artifact.Status.Phase = osbuilder.Pending
+	artifact.Status.Reason = osbuilder.ReasonResumed
+	artifact.Status.Message = message
+
+	setCondition(artifact, osbuilder.ConditionReady, metav1.ConditionFalse, osbuilder.ReasonResumed, message)
+}
+
+// markDeleting records that the artifact waits for its cleanup jobs before
+// it is deleted.
+func markDeleting(artifact *osbuilder.OSArtifact, reason, message string) {
+	artifact.Status.Phase = osbuilder.Deleting
+	artifact.Status.Reason = reason
+	artifact.Status.Message = message
+
+	setCondition(artifact, osbuilder.ConditionReady, metav1.ConditionFalse, reason, message)
+}
+
+// markReexporting resets the export stage after only the exporters changed,
+// so that they run again on the files already built.
+func markReexporting(artifact *osbuilder.OSArtifact) {
+	markExporting(artifact)
+	artifact.Status.ObservedGeneration = artifact.Generation
+	artifact.Status.CompletionTime = nil
+	artifact.Status.Reason = osbuilder.ReasonSpecChanged
+	artifact.Status.Message = fmt.Sprintf("Exporters changed, exporting generation %d", artifact.Generation)
+	for i := range artifact.Status.Artifacts {
+		artifact.Status.Artifacts[i].URLs = nil
+	}
+}
+
+// markExporting records a successful build and the start of the export stage.
+func markExporting(artifact *osbuilder.OSArtifact) {
+	now := metav1.Now()
+	artifact.Status.Phase = osbuilder.Exporting
+	artifact.Status.ExportStartTime = &now
+	// Every exporter runs again, also after a suspended export resumes
+	artifact.Status.Exports = nil
+	artifact.Status.ExportHash = artifact.Spec.ExportHash()
+	artifact.Status.Reason = osbuilder.ReasonExporting
+	artifact.Status.Message = ""
+
+	setCondition(artifact, osbuilder.ConditionSourceResolved, metav1.ConditionTrue, osbuilder.ReasonResolved, "")
+	setCondition(artifact, osbuilder.ConditionBuilt, metav1.ConditionTrue, osbuilder.ReasonBuildSucceeded, "")
+	setCondition(artifact, osbuilder.ConditionExported, metav1.ConditionFalse, osbuilder.ReasonExporting, "Running exporters")
+	setCondition(artifact, osbuilder.ConditionReady, metav1.ConditionFalse, osbuilder.ReasonExporting, "Running exporters")
+}
+
+// markReady records that every exporter succeeded.
+func markReady(artifact *osbuilder.OSArtifact) {
+	now := metav1.Now()
+	artifact.Status.Phase = osbuilder.Ready
+	artifact.Status.CompletionTime = &now
+	artifact.Status.Reason = osbuilder.ReasonArtifactAvailable
+	artifact.Status.Message = ""
+
+	setCondition(artifact, osbuilder.ConditionExported, metav1.ConditionTrue, osbuilder.ReasonExportSucceeded, "")
+	setCondition(artifact, osbuilder.ConditionReady, metav1.ConditionTrue, osbuilder.ReasonArtifactAvailable, "")
+}
+
+// markFailed moves the artifact to Error, setting condType to False with the
+// given reason and message. Ready is always set to False alongside it.
+func markFailed(artifact *osbuilder.OSArtifact, condType, reason, message string) {
+	now := metav1.Now()
+	artifact.Status.Phase = osbuilder.Error
+	artifact.Status.CompletionTime = &now
+	artifact.Status.Reason = reason
+	artifact.Status.Message = message
+
+	setCondition(artifact, condType, metav1.ConditionFalse, reason, message)
+	setCondition(artifact, osbuilder.ConditionReady, metav1.ConditionFalse, reason, message)
+}
+
+// updateSourceResolved sets SourceResolved to True once every init container
+// preparing the rootfs has completed successfully. It reports whether the
+// condition changed.
+func updateSourceResolved(artifact *osbuilder.OSArtifact, pod *corev1.Pod) bool {
+	if meta.IsStatusConditionTrue(artifact.Status.Conditions, osbuilder.ConditionSourceResolved) {
+		return false
+	}
+
+	statuses := make(map[string]corev1.ContainerStatus, len(pod.Status.InitContainerStatuses))
+	for _, status := range pod.Status.InitContainerStatuses {
+		statuses[status.Name] = status
+	}
+	for _, container := range pod.Spec.InitContainers {
+		if buildSteps[container.Name] {
+			continue
+		}
+		status, ok := statuses[container.Name]
+		if !ok || status.State.Terminated == nil || status.State.Terminated.ExitCode != 0 {
+			return false
+		}
+	}
+
+	setCondition(artifact, osbuilder.ConditionSourceResolved, metav1.ConditionTrue, osbuilder.ReasonResolved, "")
+	setCondition(artifact, osbuilder.ConditionBuilt, metav1.ConditionFalse, osbuilder.ReasonBuilding, "Building artifacts")
+	return true
+}
+
+// podFailure explains why a builder pod failed. It returns the condition that
+// should be set to False along with its reason and message.
+func podFailure(pod *corev1.Pod) (condType, reason, message string) {
+	if pod.Status.Reason == "Evicted" {
+		return osbuilder.ConditionBuilt, osbuilder.ReasonEvicted, fmt.Sprintf("builder pod %s was evicted: %s", pod.Name, pod.Status.Message)
+	}
+	if podTimedOut(pod) {
+		return osbuilder.ConditionBuilt, osbuilder.ReasonTimedOut, fmt.Sprintf("builder pod %s exceeded the build timeout", pod.Name)
+	}
+
+	for _, status := range pod.Status.InitContainerStatuses {
+		if msg, failed := containerFailure(pod, status); failed {
+			if status.Name == pushImageContainerName || status.Name == ociArtifactContainerName {
+				return osbuilder.ConditionBuilt, osbuilder.ReasonPushFailed, msg
+			}
+			if buildSteps[status.Name] {
+				return osbuilder.ConditionBuilt, osbuilder.ReasonBuildFailed, msg
+			}
+			return osbuilder.ConditionSourceResolved, osbuilder.ReasonResolutionFailed, msg
+		}
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if msg, failed := containerFailure(pod, status); failed {
+			return osbuilder.ConditionBuilt, osbuilder.ReasonBuildFailed, msg
+		}
+	}
+
+	message = fmt.Sprintf("builder pod %s failed", pod.Name)
+	if pod.Status.Message != "" {
+		message += ": " + pod.Status.Message
+	}
+	return osbuilder.ConditionBuilt, osbuilder.ReasonBuildFailed, message
+}
+
+func containerFailure(pod *corev1.Pod, status corev1.ContainerStatus) (string, bool) {
+	terminated := status.State.Terminated
+	if terminated == nil || terminated.ExitCode == 0 {
+		return "", false
+	}
+
+	message := fmt.Sprintf("container %s in builder pod %s exited with code %d", status.Name, pod.Name, terminated.ExitCode)
+	if terminated.Reason != "" {
+		message += fmt.Sprintf(" (%s)", terminated.Reason)
+	}
+	if details := strings.TrimSpace(terminated.Message); details != "" {
+		message += ": " + details
+	}
+
+	return message, true
+}
@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Status", func() {
+	var artifact *osbuilder.OSArtifact
+	var pod *corev1.Pod
+
+	BeforeEach(func() {
+		artifact = &osbuilder.OSArtifact{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Generation: 2},
+		}
+		pod = &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-abcde"},
+			Spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{{Name: "pull-image-baseimage"}},
+				Containers:     []corev1.Container{{Name: "build-iso"}},
+			},
+		}
+		markBuilding(artifact)
+	})
+
+	Describe("markBuilding", func() {
+		It("records the generation being built", func() {
+			Expect(artifact.Status.Phase).To(BeEquivalentTo(osbuilder.Building))
+			Expect(artifact.Status.ObservedGeneration).To(BeEquivalentTo(2))
+			Expect(artifact.Status.StartTime).ToNot(BeNil())
+			Expect(meta.IsStatusConditionFalse(artifact.Status.Conditions, osbuilder.ConditionReady)).To(BeTrue())
+		})
+	})
+
+	Describe("updateSourceResolved", func() {
+		It("waits for every init container preparing the rootfs", func() {
+			Expect(updateSourceResolved(artifact, pod)).To(BeFalse())
+
+			pod.Status.InitContainerStatuses = []corev1.ContainerStatus{{
+				Name:  "pull-image-baseimage",
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0}},
+			}}
+			pod.Spec.InitContainers = append(pod.Spec.InitContainers, corev1.Container{Name: "build-iso"})
+			Expect(updateSourceResolved(artifact, pod)).To(BeTrue())
+			Expect(meta.IsStatusConditionTrue(artifact.Status.Conditions, osbuilder.ConditionSourceResolved)).To(BeTrue())
+			Expect(updateSourceResolved(artifact, pod)).To(BeFalse())
+		})
+	})
+
+	Describe("podFailure", func() {
+		It("blames source resolution when an init container fails", func() {
+			pod.Status.InitContainerStatuses = []corev1.ContainerStatus{{
+				Name: "pull-image-baseimage",
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+					ExitCode: 1,
+					Reason:   "Error",
+					Message:  "registry timeout",
+				}},
+			}}
+
+			condType, reason, message := podFailure(pod)
+			Expect(condType).To(Equal(osbuilder.ConditionSourceResolved))
+			Expect(reason).To(Equal(osbuilder.ReasonResolutionFailed))
+			Expect(message).To(ContainSubstring("pull-image-baseimage"))
+			Expect(message).To(ContainSubstring("registry timeout"))
+		})
+
+		It("blames the build when a build step fails", func() {
+			pod.Spec.InitContainers = append(pod.Spec.InitContainers, corev1.Container{Name: "build-cloud-image"})
+			pod.Status.InitContainerStatuses = []corev1.ContainerStatus{
+				{
+					Name:  "pull-image-baseimage",
+					State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0}},
+				},
+				{
+					Name:  "build-cloud-image",
+					State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1}},
+				},
+			}
+
+			condType, reason, message := podFailure(pod)
+			Expect(condType).To(Equal(osbuilder.ConditionBuilt))
+			Expect(reason).To(Equal(osbuilder.ReasonBuildFailed))
+			Expect(message).To(ContainSubstring("build-cloud-image"))
+		})
+
+		It("blames the build when a build container fails", func() {
+			pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+				Name:  "build-iso",
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 2}},
+			}}
+
+			condType, reason, message := podFailure(pod)
+			Expect(condType).To(Equal(osbuilder.ConditionBuilt))
+			Expect(reason).To(Equal(osbuilder.ReasonBuildFailed))
+			Expect(message).To(ContainSubstring("build-iso"))
+			Expect(message).To(ContainSubstring("code 2"))
+		})
+
+		It("reports evictions", func() {
+			pod.Status.Reason = "Evicted"
+
+			_, reason, _ := podFailure(pod)
+			Expect(reason).To(Equal(osbuilder.ReasonEvicted))
+		})
+
+		It("reports pods killed for exceeding the build timeout", func() {
+			pod.Status.Reason = "DeadlineExceeded"
+
+			condType, reason, _ := podFailure(pod)
+			Expect(condType).To(Equal(osbuilder.ConditionBuilt))
+			Expect(reason).To(Equal(osbuilder.ReasonTimedOut))
+		})
+	})
+
+	Describe("markSuspended", func() {
+		It("resumes an interrupted build from scratch", func() {
+			markSuspended(artifact)
+			Expect(artifact.Status.Phase).To(BeEquivalentTo(osbuilder.Suspended))
+			Expect(artifact.Status.Reason).To(Equal(osbuilder.ReasonSuspended))
+
+			markResumed(artifact)
+			Expect(artifact.Status.Phase).To(BeEquivalentTo(osbuilder.Pending))
+		})
+
+		It("resumes an interrupted export with the exporters", func() {
+			markExporting(artifact)
+			markSuspended(artifact)
+			Expect(meta.IsStatusConditionPresentAndEqual(artifact.Status.Conditions, osbuilder.ConditionExported, metav1.ConditionUnknown)).To(BeTrue())
+
+			markResumed(artifact)
+			Expect(artifact.Status.Phase).To(BeEquivalentTo(osbuilder.Exporting))
+		})
+	})
+
+	Describe("markFailed", func() {
+		It("surfaces the reason on the status and the Ready condition", func() {
+			markFailed(artifact, osbuilder.ConditionBuilt, osbuilder.ReasonBuildFailed, "boom")
+
+			Expect(artifact.Status.Phase).To(BeEquivalentTo(osbuilder.Error))
+			Expect(artifact.Status.Reason).To(Equal(osbuilder.ReasonBuildFailed))
+			Expect(artifact.Status.Message).To(Equal("boom"))
+			Expect(artifact.Status.CompletionTime).ToNot(BeNil())
+			ready := meta.FindStatusCondition(artifact.Status.Conditions, osbuilder.ConditionReady)
+			Expect(ready.Status).To(Equal(metav1.ConditionFalse))
+			Expect(ready.Reason).To(Equal(osbuilder.ReasonBuildFailed))
+		})
+	})
+})
@@ -26,10 +26,12 @@ import (
 	. "github.com/onsi/gomega"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
@@ -107,3 +109,13 @@ func deleteNamepace(clientset *kubernetes.Clientset, name string) {
 	err := clientset.CoreV1().Namespaces().Delete(context.Background(), name, metav1.DeleteOptions{})
 	Expect(err).ToNot(HaveOccurred())
 }
+
+// newFakeClient returns a client backed by objects, for the specs that do not
+// need an API server.
+func newFakeClient(objects ...client.Object) client.Client {
+	fakeScheme := runtime.NewScheme()
+	Expect(scheme.AddToScheme(fakeScheme)).To(Succeed())
+	Expect(buildv1alpha2.AddToScheme(fakeScheme)).To(Succeed())
+
+	return fake.NewClientBuilder().WithScheme(fakeScheme).WithObjects(objects...).Build()
+}
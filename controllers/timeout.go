@@ -0,0 +1,86 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// deadlineExceededReason is set by the kubelet on pods and by the job
+// controller on jobs running past their activeDeadlineSeconds.
+const deadlineExceededReason = "DeadlineExceeded"
+
+// activeDeadlineSeconds converts a timeout to activeDeadlineSeconds, rounding
+// up to whole seconds.
+func activeDeadlineSeconds(timeout *metav1.Duration) *int64 {
+	if timeout == nil {
+		return nil
+	}
+	return ptr(int64((timeout.Duration + time.Second - 1) / time.Second))
+}
+
+// timeRemaining returns how much of timeout is left when measured from
+// start. ok is false when there is no timeout to enforce.
+func timeRemaining(start *metav1.Time, timeout *metav1.Duration) (remaining time.Duration, ok bool) {
+	if start == nil || timeout == nil {
+		return 0, false
+	}
+	return time.Until(start.Add(timeout.Duration)), true
+}
+
+// buildTimeRemaining returns how long the current build attempt may still
+// run. The kubelet only enforces activeDeadlineSeconds once the pod started,
+// so the controller also times out pods that never got scheduled.
+func buildTimeRemaining(artifact *osbuilder.OSArtifact) (time.Duration, bool) {
+	start := artifact.Status.StartTime
+	if current := currentAttempt(artifact); current != nil {
+		start = current.StartTime
+	}
+	return timeRemaining(start, artifact.Spec.BuildTimeout)
+}
+
+// exportTimeRemaining returns how long the exporters may still run, measured
+// from when markExporting last started them.
+func exportTimeRemaining(artifact *osbuilder.OSArtifact) (time.Duration, bool) {
+	if artifact.Status.Phase != osbuilder.Exporting {
+		return 0, false
+	}
+	return timeRemaining(artifact.Status.ExportStartTime, artifact.Spec.ExportTimeout)
+}
+
+// podTimedOut reports whether the kubelet killed the pod for running past its
+// activeDeadlineSeconds.
+func podTimedOut(pod *corev1.Pod) bool {
+	return pod.Status.Reason == deadlineExceededReason
+}
+
+// jobTimedOut reports whether the job failed for running past its
+// activeDeadlineSeconds.
+func jobTimedOut(job *batchv1.Job) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue &&
+			condition.Reason == deadlineExceededReason {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"time"
+
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Timeouts", func() {
+	var artifact *osbuilder.OSArtifact
+
+	BeforeEach(func() {
+		artifact = &osbuilder.OSArtifact{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Generation: 1},
+			Spec: osbuilder.OSArtifactSpec{
+				BuildTimeout:  &metav1.Duration{Duration: 90 * time.Minute},
+				ExportTimeout: &metav1.Duration{Duration: 1500 * time.Millisecond},
+			},
+		}
+		markBuilding(artifact)
+	})
+
+	It("rounds activeDeadlineSeconds up", func() {
+		Expect(activeDeadlineSeconds(nil)).To(BeNil())
+		Expect(*activeDeadlineSeconds(artifact.Spec.BuildTimeout)).To(BeEquivalentTo(5400))
+		Expect(*activeDeadlineSeconds(artifact.Spec.ExportTimeout)).To(BeEquivalentTo(2))
+	})
+
+	It("measures the build timeout from the start of the current attempt", func() {
+		remaining, ok := buildTimeRemaining(artifact)
+		Expect(ok).To(BeTrue())
+		Expect(remaining).To(BeNumerically("~", 90*time.Minute, time.Minute))
+
+		startAttempt(artifact, 1, &corev1.Pod{})
+		artifact.Status.Attempts[0].StartTime = &metav1.Time{Time: time.Now().Add(-2 * time.Hour)}
+		remaining, _ = buildTimeRemaining(artifact)
+		Expect(remaining).To(BeNumerically("<", 0))
+
+		artifact.Spec.BuildTimeout = nil
+		_, ok = buildTimeRemaining(artifact)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("measures the export timeout once the build succeeded", func() {
+		_, ok := exportTimeRemaining(artifact)
+		Expect(ok).To(BeFalse())
+
+		markExporting(artifact)
+		remaining, ok := exportTimeRemaining(artifact)
+		Expect(ok).To(BeTrue())
+		Expect(remaining).To(BeNumerically("<=", 1500*time.Millisecond))
+	})
+
+	It("restarts the export timeout when the exporters run again", func() {
+		markExporting(artifact)
+		anHourAgo := metav1.NewTime(time.Now().Add(-time.Hour))
+		artifact.Status.ExportStartTime = &anHourAgo
+		meta.FindStatusCondition(artifact.Status.Conditions, osbuilder.ConditionExported).LastTransitionTime = anHourAgo
+		markFailed(artifact, osbuilder.ConditionExported, osbuilder.ReasonExportFailed, "exporter failed")
+		_, ok := exportTimeRemaining(artifact)
+		Expect(ok).To(BeFalse())
+
+		markReexporting(artifact)
+		remaining, ok := exportTimeRemaining(artifact)
+		Expect(ok).To(BeTrue())
+		Expect(remaining).To(BeNumerically(">", time.Second))
+	})
+
+	It("recognises jobs past their deadline", func() {
+		job := &batchv1.Job{}
+		Expect(jobTimedOut(job)).To(BeFalse())
+
+		job.Status.Conditions = []batchv1.JobCondition{{
+			Type:   batchv1.JobFailed,
+			Status: corev1.ConditionTrue,
+			Reason: "DeadlineExceeded",
+		}}
+		Expect(jobTimedOut(job)).To(BeTrue())
+	})
+})
@@ -0,0 +1,167 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// retainedLabel marks an artifacts volume kept after its OSArtifact was
+// deleted, with the name of that artifact as value.
+const retainedLabel = "build.kairos.io/retained-from"
+
+// nodeNameField selects a node by name in node affinity terms.
+const nodeNameField = "metadata.name"
+
+// sharedVolume reports whether pvc can be mounted from several nodes at once.
+// The access modes of a bound claim are those of its volume.
+func sharedVolume(pvc *corev1.PersistentVolumeClaim) bool {
+	accessModes := pvc.Status.AccessModes
+	if len(accessModes) == 0 {
+		accessModes = pvc.Spec.AccessModes
+	}
+	for _, mode := range accessModes {
+		if mode == corev1.ReadWriteMany || mode == corev1.ReadOnlyMany {
+			return true
+		}
+	}
+	return false
+}
+
+// builderNode returns the node the successful build ran on, or "" if it is
+// unknown.
+func builderNode(artifact *osbuilder.OSArtifact) string {
+	current := currentAttempt(artifact)
+	if current == nil || current.Outcome != osbuilder.AttemptSucceeded {
+		return ""
+	}
+	return current.Node
+}
+
+// colocateWithVolume requires a pod mounting pvc to run on the builder node
+// when the volume cannot be shared across nodes, as it stays attached there.
+// The node is added to every required node selector term, so that the
+// exporter's own affinity still applies.
+func colocateWithVolume(podSpec *corev1.PodSpec, artifact *osbuilder.OSArtifact, pvc *corev1.PersistentVolumeClaim) {
+	node := builderNode(artifact)
+	if node == "" || sharedVolume(pvc) {
+		return
+	}
+
+	requirement := corev1.NodeSelectorRequirement{
+		Key:      nodeNameField,
+		Operator: corev1.NodeSelectorOpIn,
+		Values:   []string{node},
+	}
+
+	if podSpec.Affinity == nil {
+		podSpec.Affinity = &corev1.Affinity{}
+	}
+	if podSpec.Affinity.NodeAffinity == nil {
+		podSpec.Affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+	nodeAffinity := podSpec.Affinity.NodeAffinity
+	if nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &corev1.NodeSelector{}
+	}
+	selector := nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if len(selector.NodeSelectorTerms) == 0 {
+		selector.NodeSelectorTerms = []corev1.NodeSelectorTerm{{}}
+	}
+	for i := range selector.NodeSelectorTerms {
+		term := &selector.NodeSelectorTerms[i]
+		term.MatchFields = append(term.MatchFields, requirement)
+	}
+}
+
+// releaseVolume detaches the artifacts volume from an artifact being
+// deleted, so that the garbage collector keeps it. Volumes are only detached
+// when the reclaim policy is Retain or Orphan.
+func (r *OSArtifactReconciler) releaseVolume(ctx context.Context, artifact *osbuilder.OSArtifact) error {
+	policy := artifact.Spec.VolumeReclaimPolicy
+	if policy != osbuilder.VolumeReclaimRetain && policy != osbuilder.VolumeReclaimOrphan {
+		return nil
+	}
+
+	var pvcs corev1.PersistentVolumeClaimList
+	if err := r.List(ctx, &pvcs, &client.ListOptions{
+		Namespace: artifact.Namespace,
+		LabelSelector: labels.SelectorFromSet(labels.Set{
+			artifactLabel: artifact.Name,
+		}),
+	}); err != nil {
+		return err
+	}
+
+	for i := range pvcs.Items {
+		pvc := &pvcs.Items[i]
+		if pvc.DeletionTimestamp != nil {
+			continue
+		}
+
+		releaseFrom(pvc, artifact)
+		if policy == osbuilder.VolumeReclaimRetain {
+			pvc.Labels[retainedLabel] = artifact.Name
+		}
+		if err := r.Update(ctx, pvc); err != nil {
+			return err
+		}
+		log.FromContext(ctx).Info("Kept the artifacts volume", "pvc", pvc.Name, "policy", policy)
+	}
+
+	return nil
+}
+
+// releaseFrom removes the owner reference and labels tying pvc to artifact.
+func releaseFrom(pvc *corev1.PersistentVolumeClaim, artifact *osbuilder.OSArtifact) {
+	var owners []metav1.OwnerReference
+	for _, owner := range pvc.OwnerReferences {
+		if owner.UID != artifact.UID {
+			owners = append(owners, owner)
+		}
+	}
+	pvc.OwnerReferences = owners
+
+	if pvc.Labels == nil {
+		pvc.Labels = map[string]string{}
+	}
+	delete(pvc.Labels, artifactLabel)
+}
+
+// adoptVolume makes artifact the owner of a volume retained from a deleted
+// artifact of the same name. It reports whether pvc was changed.
+func (r *OSArtifactReconciler) adoptVolume(artifact *osbuilder.OSArtifact, pvc *corev1.PersistentVolumeClaim) (bool, error) {
+	if pvc.Labels[retainedLabel] != artifact.Name {
+		return false, nil
+	}
+
+	delete(pvc.Labels, retainedLabel)
+	pvc.Labels[artifactLabel] = artifact.Name
+	if err := controllerutil.SetOwnerReference(artifact, pvc, r.Scheme()); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,138 @@
+package controllers
+
+import (
+	"context"
+
+	osbuilder "github.com/kairos-io/osbuilder/api/v1alpha2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("Volume", func() {
+	var artifact *osbuilder.OSArtifact
+	var pvc *corev1.PersistentVolumeClaim
+
+	BeforeEach(func() {
+		artifact = &osbuilder.OSArtifact{
+			TypeMeta:   metav1.TypeMeta{APIVersion: osbuilder.GroupVersion.String(), Kind: "OSArtifact"},
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default", UID: "new"},
+		}
+		pvc = &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-artifacts",
+				Namespace: "default",
+				Labels:    map[string]string{artifactLabel: "test"},
+				OwnerReferences: []metav1.OwnerReference{
+					{APIVersion: osbuilder.GroupVersion.String(), Kind: "OSArtifact", Name: "test", UID: "old"},
+				},
+			},
+		}
+	})
+
+	It("retains a volume for an artifact of the same name", func() {
+		releaseFrom(pvc, &osbuilder.OSArtifact{ObjectMeta: metav1.ObjectMeta{Name: "test", UID: "old"}})
+		pvc.Labels[retainedLabel] = "test"
+		Expect(pvc.OwnerReferences).To(BeEmpty())
+		Expect(pvc.Labels).ToNot(HaveKey(artifactLabel))
+
+		r := &OSArtifactReconciler{Client: newFakeClient()}
+
+		adopted, err := r.adoptVolume(artifact, pvc)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(adopted).To(BeTrue())
+		Expect(pvc.Labels).To(HaveKeyWithValue(artifactLabel, "test"))
+		Expect(pvc.Labels).ToNot(HaveKey(retainedLabel))
+		Expect(pvc.OwnerReferences).To(ConsistOf(HaveField("UID", artifact.UID)))
+	})
+
+	It("does not adopt volumes of other artifacts", func() {
+		r := &OSArtifactReconciler{}
+		adopted, err := r.adoptVolume(artifact, pvc)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(adopted).To(BeFalse())
+	})
+
+	It("does not build into a volume orphaned by an artifact of the same name", func() {
+		old := &osbuilder.OSArtifact{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default", UID: "old"},
+			Spec:       osbuilder.OSArtifactSpec{VolumeReclaimPolicy: osbuilder.VolumeReclaimOrphan},
+		}
+		r := &OSArtifactReconciler{Client: newFakeClient(old, pvc)}
+		Expect(r.releaseVolume(context.TODO(), old)).To(Succeed())
+		Expect(r.Delete(context.TODO(), old)).To(Succeed())
+
+		artifact.Spec.ImageName = "quay.io/kairos/core-opensuse:latest"
+		artifact.Finalizers = []string{FinalizerName}
+		artifact.Generation = 1
+		Expect(r.Create(context.TODO(), artifact)).To(Succeed())
+		_, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(artifact)})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(r.Get(context.TODO(), client.ObjectKeyFromObject(artifact), artifact)).To(Succeed())
+		Expect(artifact.Status.Phase).To(BeEquivalentTo(osbuilder.Error))
+		Expect(artifact.Status.Reason).To(Equal(osbuilder.ReasonVolumeConflict))
+		var pods corev1.PodList
+		Expect(r.List(context.TODO(), &pods, client.InNamespace("default"))).To(Succeed())
+		Expect(pods.Items).To(BeEmpty())
+	})
+	Context("with a volume attached to the builder node", func() {
+		BeforeEach(func() {
+			pvc.Spec.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+			artifact.Status.Attempts = []osbuilder.BuildAttempt{
+				{Attempt: 1, Pod: "test-abcde", Node: "worker-1", Outcome: osbuilder.AttemptSucceeded},
+			}
+		})
+
+		It("runs exporters on the builder node", func() {
+			podSpec := &corev1.PodSpec{Affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+					NodeSelectorTerms: []corev1.NodeSelectorTerm{
+						{MatchExpressions: []corev1.NodeSelectorRequirement{
+							{Key: "kubernetes.io/arch", Operator: corev1.NodeSelectorOpIn, Values: []string{"amd64"}},
+						}},
+						{MatchExpressions: []corev1.NodeSelectorRequirement{
+							{Key: "kubernetes.io/arch", Operator: corev1.NodeSelectorOpIn, Values: []string{"arm64"}},
+						}},
+					},
+				},
+			}}}
+			colocateWithVolume(podSpec, artifact, pvc)
+
+			terms := podSpec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+			Expect(terms).To(HaveLen(2))
+			for _, term := range terms {
+				Expect(term.MatchExpressions).To(HaveLen(1))
+				Expect(term.MatchFields).To(ConsistOf(corev1.NodeSelectorRequirement{
+					Key: nodeNameField, Operator: corev1.NodeSelectorOpIn, Values: []string{"worker-1"},
+				}))
+			}
+		})
+
+		It("adds node affinity to exporters without any", func() {
+			podSpec := &corev1.PodSpec{}
+			colocateWithVolume(podSpec, artifact, pvc)
+
+			Expect(podSpec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms).To(ConsistOf(
+				HaveField("MatchFields", ConsistOf(HaveField("Values", []string{"worker-1"}))),
+			))
+		})
+
+		It("lets exporters run anywhere when the bound volume is shared", func() {
+			pvc.Status.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany}
+			podSpec := &corev1.PodSpec{}
+			colocateWithVolume(podSpec, artifact, pvc)
+			Expect(podSpec.Affinity).To(BeNil())
+		})
+
+		It("lets exporters run anywhere when the builder node is unknown", func() {
+			artifact.Status.Attempts[0].Node = ""
+			podSpec := &corev1.PodSpec{}
+			colocateWithVolume(podSpec, artifact, pvc)
+			Expect(podSpec.Affinity).To(BeNil())
+		})
+	})
+})
@@ -52,13 +52,48 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
-	var serveImage, toolImage, copierImage string
+	var serveImage, toolImage, copierImage, pushImage, orasImage, s3Image string
+	var cosignImage, gpgImage string
+	var serveNamespace, serveVolume, serveRole, serveURL string
+	var buildResourcesConfig string
+	var maxConcurrentBuilds, maxConcurrentBuildsPerNamespace int
 
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 
 	// It needs luet inside
 	flag.StringVar(&toolImage, "tool-image", "quay.io/kairos/auroraboot:latest", "Tool image.")
 
+	flag.StringVar(&pushImage, "push-image", controllers.DefaultPushImage, "Image providing crane, used to push built images to registries.")
+
+	flag.StringVar(&orasImage, "oras-image", controllers.DefaultOrasImage, "Image providing oras, used to push OCI artifacts to registries.")
+
+	flag.StringVar(&cosignImage, "cosign-image", controllers.DefaultCosignImage,
+		"Image providing cosign v2 and a shell, used to sign the artifacts with spec.signing. "+
+			"The image signatures are expected under cosign's sha256-<digest>.sig tags.")
+	flag.StringVar(&gpgImage, "gpg-image", controllers.DefaultGPGImage,
+		"Image providing gpg and a shell, used to sign the artifacts with spec.signing.")
+
+	flag.StringVar(&s3Image, "s3-image", controllers.DefaultS3Image, "Image providing the AWS CLI, used by the S3 exporters.")
+
+	flag.StringVar(&serveNamespace, "serve-namespace", "",
+		"Namespace of the HTTP server serving the artifacts with spec.serve. Serving is disabled when empty.")
+	flag.StringVar(&serveImage, "serve-image", controllers.DefaultServingImage, "Image of the HTTP server serving the artifacts.")
+	flag.StringVar(&serveVolume, "serve-volume", "nginx-public", "PVC the HTTP server serves the artifacts from.")
+	flag.StringVar(&serveRole, "serve-role", "artifactCopier",
+		"Role in the serve namespace granting exec access to the HTTP server pod, bound to the copier jobs.")
+	flag.StringVar(&serveURL, "serve-url", "", "Base URL of the HTTP server, used in the download URLs of the artifacts. The URLs are relative when empty.")
+	flag.StringVar(&copierImage, "copier-image", controllers.DefaultCopierImage,
+		"Image providing kubectl, used to copy the artifacts to the HTTP server.")
+
+	flag.StringVar(&buildResourcesConfig, "build-resources-config", "",
+		"Path to a YAML file with the default compute resources of the builder containers, "+
+			"in the format of spec.resources.")
+
+	flag.IntVar(&maxConcurrentBuilds, "max-concurrent-builds", 0,
+		"Maximum number of builds running at once in the cluster, further artifacts are queued. 0 means no limit.")
+	flag.IntVar(&maxConcurrentBuildsPerNamespace, "max-concurrent-builds-per-namespace", 0,
+		"Maximum number of builds running at once in a namespace, further artifacts are queued. 0 means no limit.")
+
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
@@ -95,14 +130,43 @@ func main() {
 		os.Exit(1)
 	}
 
+	var buildResources *buildv1alpha2.BuildResources
+	if buildResourcesConfig != "" {
+		if buildResources, err = controllers.LoadBuildResources(buildResourcesConfig); err != nil {
+			setupLog.Error(err, "unable to load build resources")
+			os.Exit(1)
+		}
+	}
+
 	if err = (&controllers.OSArtifactReconciler{
-		ServingImage: serveImage,
-		ToolImage:    toolImage,
-		CopierImage:  copierImage,
+		ServingImage:   serveImage,
+		ToolImage:      toolImage,
+		CopierImage:    copierImage,
+		PushImage:      pushImage,
+		OrasImage:      orasImage,
+		CosignImage:    cosignImage,
+		GPGImage:       gpgImage,
+		S3Image:        s3Image,
+		BuildResources: buildResources,
+
+		ServeNamespace: serveNamespace,
+		ServeVolume:    serveVolume,
+		ServeRole:      serveRole,
+		ServeURL:       serveURL,
+
+		MaxConcurrentBuilds:             maxConcurrentBuilds,
+		MaxConcurrentBuildsPerNamespace: maxConcurrentBuildsPerNamespace,
+		APIReader:                       mgr.GetAPIReader(),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "OSArtifact")
 		os.Exit(1)
 	}
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&buildv1alpha2.OSArtifact{}).SetupWebhookWithManager(mgr, toolImage); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "OSArtifact")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -1,7 +1,7 @@
 #!/bin/bash
 
-# TODO: Bump to some recent kubernetes version
-KUBE_VERSION=${KUBE_VERSION:-v1.22.7}
+# CEL validation rules on the CRD need at least v1.25
+KUBE_VERSION=${KUBE_VERSION:-v1.27.3}
 CLUSTER_NAME="${CLUSTER_NAME:-kairos-osbuilder-e2e}"
 
 if ! kind get clusters | grep "$CLUSTER_NAME"; then
@@ -49,9 +49,9 @@ var _ = Describe("ISO build test", func() {
 				ImageName: "quay.io/kairos/core-opensuse:latest",
 				ISO:       true,
 				DiskSize:  "",
-				Exporters: []batchv1.JobSpec{
+				Exporters: []osbuilder.Exporter{
 					{
-						Template: corev1.PodTemplateSpec{
+						Template: &corev1.PodTemplateSpec{
 							Spec: corev1.PodSpec{
 								RestartPolicy: corev1.RestartPolicyNever,
 								Containers: []corev1.Container{